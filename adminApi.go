@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// adminPrefix is the URL prefix of the management API used by the Web UI.
+const adminPrefix = "/__admin"
+
+// registerAdminRoutes adds the management API used by the Web UI to router.
+func registerAdminRoutes(router *mux.Router) {
+	admin := router.PathPrefix(adminPrefix).Subrouter()
+	admin.Use(guardAdminWrites)
+	registerGeneratorAdmin(admin)
+	registerFileAdmin(admin)
+	registerInspectorAdmin(admin)
+	registerExportAdmin(admin)
+	registerLANAdmin(admin)
+	registerRateLimitAdmin(admin)
+}
+
+// guardAdminWrites refuses admin requests changing the mocks from pages of
+// other sites, which may post a form or a text/plain body without a
+// preflight. Browsers send the Origin of such requests: pages of the server
+// itself pass. Other clients send X-Requested-With and JSON bodies, which a
+// page of another site cannot do without a preflight the admin API refuses.
+func guardAdminWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet || r.Method == http.MethodHead || sameHostOrigin(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		jsonBody := r.ContentLength == 0 || strings.HasPrefix(r.Header.Get("Content-Type"), "application/json")
+		if r.Header.Get("Origin") == "" && r.Header.Get("X-Requested-With") != "" && jsonBody {
+			next.ServeHTTP(w, r)
+			return
+		}
+		Lg.Warnf("Refused %s %s from origin %q", r.Method, r.URL.Path, r.Header.Get("Origin"))
+		writeJSONError(w, http.StatusForbidden, "admin requests need an Origin of this server, or X-Requested-With and a JSON body")
+	})
+}
+
+// writeJSON writes v as a JSON response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeJSONError writes {"error": message} with the given status.
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// readJSONBody decodes the JSON request body into v.
+func readJSONBody(r *http.Request, v interface{}) error {
+	defer r.Body.Close()
+	data, err := ioutil.ReadAll(http.MaxBytesReader(nil, r.Body, 32<<20))
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("invalid JSON body: %v", err)
+	}
+	return nil
+}
+
+var jsonFileNamePattern = regexp.MustCompile(`^[A-Za-z0-9_\-.]+$`)
+
+// jsonFileName validates a route name chosen in the Web UI and returns its file
+// name. Sidecar and -auth file names are refused, they would be overwritten
+// with records.
+func jsonFileName(name string) (string, error) {
+	name = strings.TrimSuffix(strings.TrimPrefix(strings.TrimSpace(name), "/"), ".json")
+	if name == "" || !jsonFileNamePattern.MatchString(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("invalid name %q, use letters, digits, '-', '_' and '.'", name)
+	}
+	file := name + ".json"
+	if isRulesFile(file) || isSchemaFile(file) || isWebSocketMockFile(file) || isAuthFile(file) {
+		return "", fmt.Errorf("%s is a rules, schema, WebSocket script or -auth file, choose another name", file)
+	}
+	return file, nil
+}
+
+// localPath checks that file is a relative path inside the current directory.
+func localPath(file string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(file))
+	if file == "" || filepath.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid file %q", file)
+	}
+	return clean, nil
+}
+
+// writeFileAtomic writes data to a temporary file next to name and renames it,
+// so readers and the file watcher never see a half written file.
+func writeFileAtomic(name string, data []byte, perm os.FileMode) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(name), "."+filepath.Base(name)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, name); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
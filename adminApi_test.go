@@ -0,0 +1,77 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSONFileName(t *testing.T) {
+	saved := authFile
+	t.Cleanup(func() { authFile = saved })
+	authFile = "auth.json"
+
+	tests := []struct {
+		name, want string
+	}{
+		{"users", "users.json"},
+		{" /users.json ", "users.json"},
+		{"v1.orders", "v1.orders.json"},
+		{"users.rules", ""},
+		{"users.rules.json", ""},
+		{"Users.Schema", ""},
+		{"chat.ws", ""},
+		{"auth", ""},
+		{"auth.json", ""},
+		{"", ""},
+		{".hidden", ""},
+		{"../users", ""},
+		{"a/b", ""},
+	}
+	for _, tt := range tests {
+		got, err := jsonFileName(tt.name)
+		if tt.want == "" {
+			if err == nil {
+				t.Errorf("jsonFileName(%q) = %q, want an error", tt.name, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("jsonFileName(%q) = %q, %v, want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestGuardAdminWrites(t *testing.T) {
+	handler := guardAdminWrites(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	tests := []struct {
+		name    string
+		method  string
+		headers map[string]string
+		body    string
+		status  int
+	}{
+		{"read", http.MethodGet, map[string]string{"Origin": "https://evil.example"}, "", 200},
+		{"Web UI", http.MethodPost, map[string]string{"Origin": "http://localhost:8080", "Content-Type": "text/plain"}, "{}", 200},
+		{"other site", http.MethodPost, map[string]string{"Origin": "https://evil.example", "Content-Type": "text/plain"}, "{}", 403},
+		{"other site with header", http.MethodDelete, map[string]string{"Origin": "https://evil.example", "X-Requested-With": "x"}, "", 403},
+		{"other port", http.MethodPut, map[string]string{"Origin": "http://localhost:3000", "Content-Type": "application/json"}, "{}", 403},
+		{"opaque origin", http.MethodPost, map[string]string{"Origin": "null"}, "", 403},
+		{"script", http.MethodPost, map[string]string{"X-Requested-With": "curl", "Content-Type": "application/json"}, "{}", 200},
+		{"script without body", http.MethodDelete, map[string]string{"X-Requested-With": "curl"}, "", 200},
+		{"script with a form", http.MethodPost, map[string]string{"X-Requested-With": "curl", "Content-Type": "application/x-www-form-urlencoded"}, "a=1", 403},
+		{"no header", http.MethodPost, map[string]string{"Content-Type": "application/json"}, "{}", 403},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, "http://localhost:8080/__admin/generator/save", strings.NewReader(tt.body))
+		for name, value := range tt.headers {
+			r.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.status)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// servedFile is a served route with the content of its file, as used by the JSON editor.
+type servedFile struct {
+	Route    string `json:"route"`
+	File     string `json:"file"`
+	Content  string `json:"content,omitempty"`
+	Modified string `json:"modified"`
+}
+
+// fileSaveRequest is sent by the JSON editor to save a file.
+type fileSaveRequest struct {
+	Content  string `json:"content"`
+	Modified string `json:"modified"` // modification time seen when the file was opened
+	Force    bool   `json:"force"`    // save even if the file changed on disk meanwhile
+}
+
+func registerFileAdmin(admin *mux.Router) {
+	admin.HandleFunc("/files", handleListFiles).Methods("GET")
+	admin.HandleFunc("/file", handleGetFile).Methods("GET")
+	admin.HandleFunc("/file", handleSaveFile).Methods("PUT")
+}
+
+// routeFile returns the file serving route.
+func routeFile(route string) (string, bool) {
+	routesLock.RLock()
+	defer routesLock.RUnlock()
+	file, ok := routeFiles[route]
+	return file, ok
+}
+
+func modifiedTime(file string) (string, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return "", err
+	}
+	return info.ModTime().UTC().Format(time.RFC3339Nano), nil
+}
+
+// handleListFiles lists all served routes with their files.
+func handleListFiles(w http.ResponseWriter, r *http.Request) {
+	routesLock.RLock()
+	files := make([]servedFile, 0, len(routeFiles))
+	for route, file := range routeFiles {
+		files = append(files, servedFile{Route: route, File: file})
+	}
+	routesLock.RUnlock()
+
+	for i := range files {
+		files[i].Modified, _ = modifiedTime(files[i].File)
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Route < files[j].Route })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"files": files})
+}
+
+// handleGetFile returns the on-disk content of the file serving ?route=.
+func handleGetFile(w http.ResponseWriter, r *http.Request) {
+	route := r.URL.Query().Get("route")
+	file, ok := routeFile(route)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "unknown route "+route)
+		return
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	modified, _ := modifiedTime(file)
+	writeJSON(w, http.StatusOK, servedFile{Route: route, File: file, Content: string(content), Modified: modified})
+}
+
+// handleSaveFile validates and atomically writes the file serving ?route=.
+// The rename is picked up by the file watcher, which notifies all /ws clients.
+func handleSaveFile(w http.ResponseWriter, r *http.Request) {
+	route := r.URL.Query().Get("route")
+	file, ok := routeFile(route)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "unknown route "+route)
+		return
+	}
+	var req fileSaveRequest
+	if err := readJSONBody(r, &req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateJSONText([]byte(req.Content)); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	current, err := modifiedTime(file)
+	if err == nil && !req.Force && req.Modified != "" && req.Modified != current {
+		writeJSON(w, http.StatusConflict, map[string]string{
+			"error":    file + " was changed on disk after it was opened",
+			"modified": current,
+		})
+		return
+	}
+
+	if err := writeFileAtomic(file, []byte(req.Content), 0644); err != nil {
+		Lg.Errorf("Error saving %s from the Web UI: %v", file, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("File %s was saved from the Web UI", file)
+	Lg.Infof("File %s was saved from the Web UI", file)
+
+	modified, _ := modifiedTime(file)
+	writeJSON(w, http.StatusOK, servedFile{Route: route, File: file, Modified: modified})
+}
+
+// validateJSONText checks that data is valid JSON and reports the line and
+// column of a syntax error.
+func validateJSONText(data []byte) error {
+	var v interface{}
+	err := json.Unmarshal(data, &v)
+	if err == nil {
+		return nil
+	}
+	if syntaxErr, ok := err.(*json.SyntaxError); ok {
+		before := data[:syntaxErr.Offset]
+		line := bytes.Count(before, []byte("\n")) + 1
+		column := len(before) - bytes.LastIndexByte(before, '\n')
+		return fmt.Errorf("invalid JSON at line %d, column %d: %v", line, column, err)
+	}
+	return fmt.Errorf("invalid JSON: %v", err)
+}
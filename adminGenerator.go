@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxPreviewRecords = 20
+	maxSavedRecords   = 100000
+)
+
+// generatorRequest is the generator configuration sent by the Web UI.
+type generatorRequest struct {
+	File      string            `json:"file"`      // served route file or samples/*.sample.json to read
+	Sample    interface{}       `json:"sample"`    // pasted sample, used when File is empty
+	Overrides map[string]string `json:"overrides"` // field path -> rule name
+	Quantity  int               `json:"quantity"`
+	Seed      uint64            `json:"seed"`
+	Unique    string            `json:"unique"`
+	AutoInc   string            `json:"autoinc"`
+	Correlate *bool             `json:"correlate"`
+	Name      string            `json:"name"` // route name used when saving
+	Overwrite bool              `json:"overwrite"`
+}
+
+func registerGeneratorAdmin(admin *mux.Router) {
+	admin.HandleFunc("/generator/samples", handleGeneratorSamples).Methods("GET")
+	admin.HandleFunc("/generator/analyze", handleGeneratorAnalyze).Methods("POST")
+	admin.HandleFunc("/generator/preview", handleGeneratorPreview).Methods("POST")
+	admin.HandleFunc("/generator/save", handleGeneratorSave).Methods("POST")
+}
+
+// handleGeneratorSamples lists the JSON files that can be used as samples:
+// the served route files and the *.sample.json files.
+func handleGeneratorSamples(w http.ResponseWriter, r *http.Request) {
+	var files []string
+	routesLock.RLock()
+	for _, file := range routeFiles {
+		if _, err := generatorSampleFile(file); err == nil {
+			files = append(files, filepath.ToSlash(file))
+		}
+	}
+	routesLock.RUnlock()
+	sort.Strings(files)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"files": files, "rules": RuleNames()})
+}
+
+// generatorSampleFile checks that file may be read as a sample: a served
+// route file or a file of the sample folder. The -auth file, rules, schemas
+// and recordings are never read.
+func generatorSampleFile(file string) (string, error) {
+	clean, err := localPath(file)
+	if err != nil {
+		return "", err
+	}
+	if isAuthFile(clean) || isRulesFile(clean) || isSchemaFile(clean) || isWebSocketMockFile(clean) {
+		return "", fmt.Errorf("%s cannot be used as a sample", file)
+	}
+	for _, part := range strings.Split(filepath.ToSlash(clean), "/") {
+		if strings.HasPrefix(part, ".") {
+			return "", fmt.Errorf("%s cannot be used as a sample", file) // e.g. .recordings
+		}
+	}
+	if filepath.Dir(clean) == filepath.Clean(samplesDir) && isSampleFile(clean) {
+		return clean, nil
+	}
+	routesLock.RLock()
+	defer routesLock.RUnlock()
+	for _, served := range routeFiles {
+		if filepath.Clean(served) == clean {
+			return clean, nil
+		}
+	}
+	return "", fmt.Errorf("%s is not a served route file or a %s file of %s", file, sampleSuffix, samplesDir)
+}
+
+// handleGeneratorAnalyze shows which rule generates every field of the sample.
+func handleGeneratorAnalyze(w http.ResponseWriter, r *http.Request) {
+	req, template, ok := readGeneratorRequest(w, r)
+	if !ok {
+		return
+	}
+	gen, ok := generatorFor(w, req)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"sample": template,
+		"fields": gen.DescribeFields(template),
+		"rules":  RuleNames(),
+	})
+}
+
+// handleGeneratorPreview generates a few records with the current settings.
+func handleGeneratorPreview(w http.ResponseWriter, r *http.Request) {
+	req, template, ok := readGeneratorRequest(w, r)
+	if !ok {
+		return
+	}
+	gen, ok := generatorFor(w, req)
+	if !ok {
+		return
+	}
+	count := req.Quantity
+	if count <= 0 || count > maxPreviewRecords {
+		count = 3
+	}
+	records := make([]interface{}, 0, count)
+	for i := 0; i < count; i++ {
+		records = append(records, gen.NewRecord(template))
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"records": records})
+}
+
+// handleGeneratorSave generates the records and saves them as a new served JSON file.
+func handleGeneratorSave(w http.ResponseWriter, r *http.Request) {
+	req, template, ok := readGeneratorRequest(w, r)
+	if !ok {
+		return
+	}
+	fileName, err := jsonFileName(req.Name)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Quantity <= 0 || req.Quantity > maxSavedRecords {
+		writeJSONError(w, http.StatusBadRequest, "quantity must be between 1 and "+strconv.Itoa(maxSavedRecords))
+		return
+	}
+	if _, err := os.Stat(fileName); err == nil && !req.Overwrite {
+		writeJSONError(w, http.StatusConflict, fileName+" already exists")
+		return
+	}
+	gen, ok := generatorFor(w, req)
+	if !ok {
+		return
+	}
+
+	records := make([]interface{}, 0, req.Quantity)
+	for i := 0; i < req.Quantity; i++ {
+		records = append(records, gen.NewRecord(template))
+	}
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := writeFileAtomic(fileName, data, 0644); err != nil {
+		Lg.Errorf("Error saving generated file %s: %v", fileName, err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("Generated %d records from the Web UI and saved to %s", req.Quantity, fileName)
+	Lg.Infof("Generated %d records from the Web UI and saved to %s", req.Quantity, fileName)
+
+	// Publish the route right away instead of waiting for the file watcher
+	scanDirectory()
+	route := "/" + strings.TrimSuffix(fileName, ".json")
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"file":  fileName,
+		"route": route,
+		"url":   serverURL() + route,
+	})
+}
+
+// readGeneratorRequest decodes the request and loads the record template.
+func readGeneratorRequest(w http.ResponseWriter, r *http.Request) (generatorRequest, interface{}, bool) {
+	var req generatorRequest
+	if err := readJSONBody(r, &req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return req, nil, false
+	}
+
+	var template interface{}
+	if req.File != "" {
+		file, err := generatorSampleFile(req.File)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return req, nil, false
+		}
+		if template, err = loadSampleTemplate(file); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return req, nil, false
+		}
+	} else {
+		template = req.Sample
+		if items, ok := template.([]interface{}); ok && len(items) > 0 {
+			template = items[0]
+		}
+	}
+	if template == nil {
+		writeJSONError(w, http.StatusBadRequest, "a sample file or sample JSON is required")
+		return req, nil, false
+	}
+	return req, template, true
+}
+
+// generatorFor creates a generator configured by the Web UI request.
+func generatorFor(w http.ResponseWriter, req generatorRequest) (*FakeGenerator, bool) {
+	gen := NewFakeGenerator(req.Seed)
+	if req.Correlate != nil {
+		gen.Correlate = *req.Correlate
+	}
+	gen.Unique = ParseUniqueFields(req.Unique)
+	sequences, err := ParseSequences(req.AutoInc)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return nil, false
+	}
+	gen.Sequences = sequences
+	for path, rule := range req.Overrides {
+		if rule != "" {
+			gen.Overrides[path] = rule
+		}
+	}
+	return gen, true
+}
@@ -0,0 +1,663 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	oauthTokenPath    = "/oauth/token"
+	oauthUserInfoPath = "/oauth/userinfo"
+	oidcDiscoveryPath = "/.well-known/openid-configuration"
+	authSecretName    = "auth-secret" // signing key used when the -auth file sets no "secret"
+	defaultAPIKeyName = "X-API-Key"
+)
+
+// authConfig is the -auth file: who may call the mock and which routes need
+// credentials.
+//
+//	{
+//	  "apiKeys": {"ci-key": {"sub": "ci", "scopes": ["read"]}},
+//	  "users":   [{"username": "alice", "password": "secret", "scopes": ["read", "write"], "claims": {"role": "admin"}}],
+//	  "clients": [{"clientId": "web", "clientSecret": "s3cret", "scopes": ["read"]}],
+//	  "protect": [{"path": "/orders/*", "methods": ["POST"], "scopes": ["write"]}, {"path": "*"}]
+//	}
+type authConfig struct {
+	Secret       string                  `json:"secret,omitempty"` // HS256 key of the issued tokens
+	Issuer       string                  `json:"issuer,omitempty"`
+	Expiry       string                  `json:"expiry,omitempty"` // lifetime of access tokens, default 1h
+	APIKeyHeader string                  `json:"apiKeyHeader,omitempty"`
+	APIKeys      map[string]authIdentity `json:"apiKeys,omitempty"`
+	Users        []authUser              `json:"users,omitempty"`
+	Clients      []authClient            `json:"clients,omitempty"`
+	Protect      []authRoute             `json:"protect,omitempty"`
+	expiry       time.Duration
+	modTime      time.Time
+}
+
+// authIdentity describes the caller using an API key.
+type authIdentity struct {
+	Subject string                 `json:"sub"`
+	Scopes  []string               `json:"scopes,omitempty"`
+	Claims  map[string]interface{} `json:"claims,omitempty"`
+}
+
+// authUser logs in with Basic auth or the password grant.
+type authUser struct {
+	Username string                 `json:"username"`
+	Password string                 `json:"password"`
+	Scopes   []string               `json:"scopes,omitempty"`
+	Claims   map[string]interface{} `json:"claims,omitempty"`
+}
+
+// authClient gets tokens with the client credentials grant.
+type authClient struct {
+	ClientID     string                 `json:"clientId"`
+	ClientSecret string                 `json:"clientSecret"`
+	Scopes       []string               `json:"scopes,omitempty"`
+	Claims       map[string]interface{} `json:"claims,omitempty"`
+}
+
+// authRoute protects the routes matching Path: /orders, /users/{id},
+// /admin/* for every path below /admin, or * for every route. The first
+// matching entry applies.
+type authRoute struct {
+	Path    string   `json:"path"`
+	Methods []string `json:"methods,omitempty"` // empty for every method
+	Schemes []string `json:"schemes,omitempty"` // apiKey, basic or bearer, empty for all of them
+	Scopes  []string `json:"scopes,omitempty"`  // all of them are required
+}
+
+// authPrincipal is the authenticated caller, its claims are available to
+// templates as {{claims.sub}} and to rules as "match": {"claims": {...}}.
+type authPrincipal struct {
+	Scheme string
+	Claims map[string]interface{}
+}
+
+type authKey struct{}
+
+var (
+	authLock       sync.Mutex
+	loadedAuth     *authConfig
+	routeParameter = regexp.MustCompile(`\{[^/]+\}`)
+)
+
+// loadAuthConfig returns the -auth file, read again when it changes. It
+// returns nil without -auth.
+func loadAuthConfig() (*authConfig, error) {
+	if authFile == "" {
+		return nil, nil
+	}
+	info, err := os.Stat(authFile)
+	if err != nil {
+		return nil, err
+	}
+	authLock.Lock()
+	defer authLock.Unlock()
+	if loadedAuth != nil && loadedAuth.modTime.Equal(info.ModTime()) {
+		return loadedAuth, nil
+	}
+	data, err := ioutil.ReadFile(authFile)
+	if err != nil {
+		return nil, err
+	}
+	config := &authConfig{modTime: info.ModTime()}
+	if err := json.Unmarshal(data, config); err != nil {
+		return nil, fmt.Errorf("invalid auth file %s: %v", authFile, err)
+	}
+	if config.Secret == "" {
+		config.Secret = generatedAuthSecret()
+	}
+	if config.APIKeyHeader == "" {
+		config.APIKeyHeader = defaultAPIKeyName
+	}
+	config.expiry = time.Hour
+	if config.Expiry != "" {
+		if config.expiry, err = time.ParseDuration(config.Expiry); err != nil {
+			return nil, fmt.Errorf("invalid expiry %q in %s", config.Expiry, authFile)
+		}
+	}
+	for _, route := range config.Protect {
+		for _, scheme := range route.Schemes {
+			if scheme != "apiKey" && scheme != "basic" && scheme != "bearer" {
+				return nil, fmt.Errorf("unknown scheme %q in %s, use apiKey, basic or bearer", scheme, authFile)
+			}
+		}
+	}
+	loadedAuth = config
+	log.Printf("Loaded auth settings from %s", authFile)
+	Lg.Infof("Loaded auth settings from %s", authFile)
+	return config, nil
+}
+
+var (
+	authSecretOnce sync.Once
+	authSecret     string
+)
+
+// generatedAuthSecret returns the key signing tokens when the -auth file sets
+// no "secret": a random key kept in the user configuration folder next to the
+// TLS certificates, so tokens stay valid across restarts.
+func generatedAuthSecret() string {
+	authSecretOnce.Do(func() {
+		file := filepath.Join(filepath.Dir(tlsCertDir()), authSecretName)
+		var err error
+		if authSecret, err = loadOrCreateSecret(file); err != nil {
+			// Tokens of this run cannot be verified after a restart
+			key := make([]byte, 32)
+			rand.Read(key)
+			authSecret = hex.EncodeToString(key)
+			log.Printf("Warning: cannot keep the token signing key in %s (%v), issued tokens end with this run", file, err)
+			Lg.Warnf("Cannot keep the token signing key in %s: %v", file, err)
+		}
+	})
+	return authSecret
+}
+
+// loadOrCreateSecret returns the key saved in file, created with 32 random
+// bytes readable by the current user only when missing.
+func loadOrCreateSecret(file string) (string, error) {
+	if data, err := ioutil.ReadFile(file); err == nil {
+		if secret := strings.TrimSpace(string(data)); len(secret) >= 32 {
+			return secret, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	secret := hex.EncodeToString(key)
+	if err := os.MkdirAll(filepath.Dir(file), 0700); err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(file, []byte(secret+"\n"), 0600); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+// isAuthFile reports whether file is the -auth file, which is not served.
+func isAuthFile(file string) bool {
+	if authFile == "" {
+		return false
+	}
+	a, err1 := filepath.Abs(file)
+	b, err2 := filepath.Abs(authFile)
+	return err1 == nil && err2 == nil && a == b
+}
+
+// issuer is the iss claim of the issued tokens.
+func (c *authConfig) issuer() string {
+	if c.Issuer != "" {
+		return c.Issuer
+	}
+	return serverURL()
+}
+
+// protection returns the entry protecting r, nil for a public request.
+func (c *authConfig) protection(r *http.Request) *authRoute {
+	for i, route := range c.Protect {
+		if len(route.Methods) > 0 && !containsFold(route.Methods, r.Method) {
+			continue
+		}
+		if matchAuthPath(route.Path, r.URL.Path) {
+			return &c.Protect[i]
+		}
+	}
+	return nil
+}
+
+// matchAuthPath matches a protected path: * matches every path, /admin/*
+// every path below /admin and {id} one segment.
+func matchAuthPath(pattern, p string) bool {
+	switch {
+	case pattern == "*":
+		return true
+	case strings.HasSuffix(pattern, "/*"):
+		return strings.HasPrefix(p+"/", strings.TrimSuffix(pattern, "*"))
+	}
+	ok, _ := path.Match(routeParameter.ReplaceAllString(pattern, "*"), p)
+	return ok
+}
+
+// requireAuth answers 401 to requests of protected routes without valid
+// credentials and 403 when their scopes are missing. The protect entries
+// also cover /graphql, /openapi.json, /docs and /health.
+func requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if authExempt(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		config, err := loadAuthConfig()
+		if err != nil {
+			Lg.Errorf("%v", err)
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		principal, authErr := authenticate(config, r)
+		if principal != nil {
+			r = r.WithContext(context.WithValue(r.Context(), authKey{}, principal))
+		}
+		route := config.protection(r)
+		if route == nil {
+			next.ServeHTTP(w, r) // public, claims are still used when credentials were sent
+			return
+		}
+		if principal == nil || (len(route.Schemes) > 0 && !containsFold(route.Schemes, principal.Scheme)) {
+			message := "credentials required"
+			if authErr != nil {
+				message = authErr.Error()
+			}
+			w.Header().Set("WWW-Authenticate", `Bearer realm="GoEasyJson", error="invalid_token"`)
+			writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "unauthorized", "error_description": message})
+			return
+		}
+		if missing := missingScopes(principal.scopes(), route.Scopes); len(missing) > 0 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="GoEasyJson", error="insufficient_scope", scope="`+strings.Join(route.Scopes, " ")+`"`)
+			writeJSON(w, http.StatusForbidden, map[string]string{"error": "insufficient_scope", "error_description": "missing scopes: " + strings.Join(missing, " ")})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// authExempt reports whether r stays public under -auth: the Web UI page and
+// its assets, the OAuth endpoints and, for this machine only, the admin API
+// and the /ws events the Web UI runs on.
+func authExempt(r *http.Request) bool {
+	p := r.URL.Path
+	switch {
+	case p == "/" || p == "/favicon.ico" || strings.HasPrefix(p, "/static/") || isAuthEndpoint(p):
+		return true
+	case adminPath(p):
+		return isLocalClient(r)
+	}
+	return false
+}
+
+// apiKeyHeader is the header carrying API keys, X-API-Key unless the -auth
+// file names another one.
+func apiKeyHeader() string {
+	if authFile != "" {
+		if config, err := loadAuthConfig(); err == nil {
+			return config.APIKeyHeader
+		}
+	}
+	return defaultAPIKeyName
+}
+
+func isAuthEndpoint(p string) bool {
+	return p == oauthTokenPath || p == oauthUserInfoPath || p == oidcDiscoveryPath
+}
+
+// authenticate reads the credentials of r: a bearer token (or access_token
+// query parameter, as browsers cannot set headers on WebSockets), Basic auth
+// or an API key. It returns nil without credentials.
+func authenticate(config *authConfig, r *http.Request) (*authPrincipal, error) {
+	authorization := r.Header.Get("Authorization")
+	scheme, credentials, _ := strings.Cut(authorization, " ")
+	token := r.URL.Query().Get("access_token")
+	switch {
+	case strings.EqualFold(scheme, "Bearer"):
+		token = strings.TrimSpace(credentials)
+		fallthrough
+	case token != "":
+		claims, err := verifyJWT(config, token)
+		if err != nil {
+			return nil, err
+		}
+		if claims["token_use"] == "refresh" {
+			return nil, errors.New("refresh tokens cannot be used as access tokens")
+		}
+		return &authPrincipal{Scheme: "bearer", Claims: claims}, nil
+	case strings.EqualFold(scheme, "Basic"):
+		username, password, ok := r.BasicAuth()
+		if !ok {
+			return nil, errors.New("invalid Basic credentials")
+		}
+		user := config.findUser(username, password)
+		if user == nil {
+			return nil, errors.New("invalid username or password")
+		}
+		return &authPrincipal{Scheme: "basic", Claims: identityClaims(user.Username, user.Scopes, user.Claims)}, nil
+	}
+	key := r.Header.Get(config.APIKeyHeader)
+	if key == "" {
+		key = r.URL.Query().Get("api_key")
+	}
+	if key == "" {
+		return nil, nil
+	}
+	for k, identity := range config.APIKeys {
+		if subtle.ConstantTimeCompare([]byte(k), []byte(key)) == 1 {
+			return &authPrincipal{Scheme: "apiKey", Claims: identityClaims(identity.Subject, identity.Scopes, identity.Claims)}, nil
+		}
+	}
+	return nil, errors.New("invalid API key")
+}
+
+func (c *authConfig) findUser(username, password string) *authUser {
+	for i, user := range c.Users {
+		if user.Username == username && subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) == 1 {
+			return &c.Users[i]
+		}
+	}
+	return nil
+}
+
+func (c *authConfig) findClient(clientID, clientSecret string) *authClient {
+	for i, client := range c.Clients {
+		if client.ClientID == clientID && subtle.ConstantTimeCompare([]byte(client.ClientSecret), []byte(clientSecret)) == 1 {
+			return &c.Clients[i]
+		}
+	}
+	return nil
+}
+
+// identityClaims are the claims of a caller: its custom claims, sub and scope.
+func identityClaims(subject string, scopes []string, custom map[string]interface{}) map[string]interface{} {
+	claims := make(map[string]interface{}, len(custom)+2)
+	for name, value := range custom {
+		claims[name] = value
+	}
+	claims["sub"] = subject
+	claims["scope"] = strings.Join(scopes, " ")
+	return claims
+}
+
+// scopes reads the space separated scope claim.
+func (p *authPrincipal) scopes() []string {
+	scope, _ := p.Claims["scope"].(string)
+	return strings.Fields(scope)
+}
+
+// authPrincipalFrom returns the caller authenticated by requireAuth, nil for
+// anonymous requests.
+func authPrincipalFrom(r *http.Request) *authPrincipal {
+	principal, _ := r.Context().Value(authKey{}).(*authPrincipal)
+	return principal
+}
+
+// requestClaims are the template values of the caller's claims.
+func requestClaims(r *http.Request) map[string]interface{} {
+	if principal := authPrincipalFrom(r); principal != nil {
+		return principal.Claims
+	}
+	return map[string]interface{}{}
+}
+
+func missingScopes(granted, required []string) []string {
+	var missing []string
+	for _, scope := range required {
+		if !containsFold(granted, scope) {
+			missing = append(missing, scope)
+		}
+	}
+	return missing
+}
+
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// signJWT returns claims as a token signed with HS256.
+func signJWT(config *authConfig, claims map[string]interface{}) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	unsigned := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + jwtSignature(config, unsigned), nil
+}
+
+func jwtSignature(config *authConfig, unsigned string) string {
+	mac := hmac.New(sha256.New, []byte(config.Secret))
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// verifyJWT checks the signature, expiry and issuer of a token and returns its claims.
+func verifyJWT(config *authConfig, token string) (map[string]interface{}, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("malformed token")
+	}
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	data, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil || json.Unmarshal(data, &header) != nil || header.Alg != "HS256" {
+		return nil, errors.New("unsupported token, expected HS256")
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(jwtSignature(config, parts[0]+"."+parts[1]))) {
+		return nil, errors.New("invalid token signature")
+	}
+	claims := map[string]interface{}{}
+	if data, err = base64.RawURLEncoding.DecodeString(parts[1]); err != nil || json.Unmarshal(data, &claims) != nil {
+		return nil, errors.New("malformed token claims")
+	}
+	if exp, ok := claims["exp"].(float64); ok && time.Now().Unix() >= int64(exp) {
+		return nil, errors.New("token expired")
+	}
+	if iss, ok := claims["iss"].(string); ok && iss != config.issuer() {
+		return nil, fmt.Errorf("token issued by %s, expected %s", iss, config.issuer())
+	}
+	return claims, nil
+}
+
+// issueTokens returns the token response of a grant: an access token, a
+// refresh token and an ID token when the openid scope was granted.
+func issueTokens(config *authConfig, audience string, claims map[string]interface{}) (map[string]interface{}, error) {
+	now := time.Now()
+	access := map[string]interface{}{}
+	for name, value := range claims {
+		access[name] = value
+	}
+	access["iss"] = config.issuer()
+	access["aud"] = audience
+	access["iat"] = now.Unix()
+	access["exp"] = now.Add(config.expiry).Unix()
+	accessToken, err := signJWT(config, access)
+	if err != nil {
+		return nil, err
+	}
+	refresh := map[string]interface{}{}
+	for name, value := range access {
+		refresh[name] = value
+	}
+	refresh["token_use"] = "refresh"
+	refresh["exp"] = now.Add(30 * 24 * time.Hour).Unix()
+	refreshToken, err := signJWT(config, refresh)
+	if err != nil {
+		return nil, err
+	}
+	response := map[string]interface{}{
+		"access_token":  accessToken,
+		"token_type":    "Bearer",
+		"expires_in":    int64(config.expiry.Seconds()),
+		"refresh_token": refreshToken,
+		"scope":         access["scope"],
+	}
+	if containsFold(strings.Fields(fmt.Sprint(access["scope"])), "openid") {
+		if response["id_token"], err = signJWT(config, access); err != nil {
+			return nil, err
+		}
+	}
+	return response, nil
+}
+
+// handleOAuthToken is the token endpoint of the mock OAuth2 provider, it
+// supports the password, client_credentials and refresh_token grants.
+func handleOAuthToken(w http.ResponseWriter, r *http.Request) {
+	config, err := loadAuthConfig()
+	if err != nil || config == nil {
+		writeJSON(w, http.StatusNotFound, map[string]string{"error": "not_found", "error_description": "start GoEasyJson with -auth auth.json"})
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		oauthError(w, http.StatusBadRequest, "invalid_request", err.Error())
+		return
+	}
+	clientID, clientSecret, hasBasic := r.BasicAuth()
+	if !hasBasic {
+		clientID, clientSecret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	requested := strings.Fields(r.PostForm.Get("scope"))
+
+	var subject string
+	var allowed []string
+	var custom map[string]interface{}
+	switch grant := r.PostForm.Get("grant_type"); grant {
+	case "password":
+		user := config.findUser(r.PostForm.Get("username"), r.PostForm.Get("password"))
+		if user == nil {
+			oauthError(w, http.StatusBadRequest, "invalid_grant", "invalid username or password")
+			return
+		}
+		subject, allowed, custom = user.Username, user.Scopes, user.Claims
+	case "client_credentials":
+		client := config.findClient(clientID, clientSecret)
+		if client == nil {
+			w.Header().Set("WWW-Authenticate", `Basic realm="GoEasyJson"`)
+			oauthError(w, http.StatusUnauthorized, "invalid_client", "invalid client_id or client_secret")
+			return
+		}
+		subject, allowed, custom = client.ClientID, client.Scopes, client.Claims
+	case "refresh_token":
+		claims, err := verifyJWT(config, r.PostForm.Get("refresh_token"))
+		if err != nil || claims["token_use"] != "refresh" {
+			oauthError(w, http.StatusBadRequest, "invalid_grant", "invalid refresh token")
+			return
+		}
+		delete(claims, "token_use")
+		principal := &authPrincipal{Claims: claims}
+		subject, allowed, custom = fmt.Sprint(claims["sub"]), principal.scopes(), claims
+	case "":
+		oauthError(w, http.StatusBadRequest, "invalid_request", "grant_type is required")
+		return
+	default:
+		oauthError(w, http.StatusBadRequest, "unsupported_grant_type", grant+" is not supported, use password, client_credentials or refresh_token")
+		return
+	}
+
+	granted := allowed
+	if len(requested) > 0 {
+		if missing := missingScopes(allowed, requested); len(missing) > 0 {
+			oauthError(w, http.StatusBadRequest, "invalid_scope", "not allowed: "+strings.Join(missing, " "))
+			return
+		}
+		granted = requested
+	}
+	if clientID == "" {
+		clientID = "goeasyjson"
+	}
+	response, err := issueTokens(config, clientID, identityClaims(subject, granted, custom))
+	if err != nil {
+		oauthError(w, http.StatusInternalServerError, "server_error", err.Error())
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, http.StatusOK, response)
+	log.Printf("Issued a token for %s with scopes %q", subject, strings.Join(granted, " "))
+	Lg.Infof("Issued a token for %s with scopes %q", subject, strings.Join(granted, " "))
+}
+
+func oauthError(w http.ResponseWriter, status int, code, description string) {
+	writeJSON(w, status, map[string]string{"error": code, "error_description": description})
+}
+
+// handleOAuthUserInfo returns the claims of the bearer token.
+func handleOAuthUserInfo(w http.ResponseWriter, r *http.Request) {
+	config, err := loadAuthConfig()
+	if err != nil || config == nil {
+		writeJSONError(w, http.StatusNotFound, "start GoEasyJson with -auth auth.json")
+		return
+	}
+	principal, err := authenticate(config, r)
+	if principal == nil || principal.Scheme != "bearer" {
+		message := "bearer token required"
+		if err != nil {
+			message = err.Error()
+		}
+		w.Header().Set("WWW-Authenticate", `Bearer realm="GoEasyJson", error="invalid_token"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token", "error_description": message})
+		return
+	}
+	writeJSON(w, http.StatusOK, principal.Claims)
+}
+
+// handleOIDCDiscovery describes the mock provider to OpenID Connect clients.
+func handleOIDCDiscovery(w http.ResponseWriter, r *http.Request) {
+	config, err := loadAuthConfig()
+	if err != nil || config == nil {
+		writeJSONError(w, http.StatusNotFound, "start GoEasyJson with -auth auth.json")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                config.issuer(),
+		"token_endpoint":                        serverURL() + oauthTokenPath,
+		"userinfo_endpoint":                     serverURL() + oauthUserInfoPath,
+		"grant_types_supported":                 []string{"password", "client_credentials", "refresh_token"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post"},
+		"id_token_signing_alg_values_supported": []string{"HS256"},
+		"scopes_supported":                      config.scopeNames(),
+		"claims_supported":                      []string{"sub", "iss", "aud", "iat", "exp", "scope"},
+	})
+}
+
+// scopeNames lists every scope of the users, clients and API keys.
+func (c *authConfig) scopeNames() []string {
+	seen := map[string]bool{"openid": true}
+	for _, user := range c.Users {
+		for _, scope := range user.Scopes {
+			seen[scope] = true
+		}
+	}
+	for _, client := range c.Clients {
+		for _, scope := range client.Scopes {
+			seen[scope] = true
+		}
+	}
+	for _, identity := range c.APIKeys {
+		for _, scope := range identity.Scopes {
+			seen[scope] = true
+		}
+	}
+	return sortedKeys(seen)
+}
+
+func registerAuthRoutes(router *mux.Router) {
+	router.HandleFunc(oauthTokenPath, handleOAuthToken).Methods("POST")
+	router.HandleFunc(oauthUserInfoPath, handleOAuthUserInfo).Methods("GET", "POST")
+	router.HandleFunc(oidcDiscoveryPath, handleOIDCDiscovery).Methods("GET")
+}
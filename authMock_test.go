@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyJWT(t *testing.T) {
+	config := &authConfig{Secret: "secret", Issuer: "http://localhost:8080"}
+	other := &authConfig{Secret: "other", Issuer: config.Issuer}
+	now := time.Now().Unix()
+	sign := func(c *authConfig, claims map[string]interface{}) string {
+		token, err := signJWT(c, claims)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	valid := sign(config, map[string]interface{}{"sub": "alice", "iss": config.Issuer, "exp": now + 60})
+	parts := strings.Split(valid, ".")
+	none := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+
+	tests := []struct {
+		name  string
+		token string
+		err   string
+	}{
+		{"valid", valid, ""},
+		{"without expiry", sign(config, map[string]interface{}{"sub": "alice"}), ""},
+		{"expired", sign(config, map[string]interface{}{"sub": "alice", "exp": now - 1}), "token expired"},
+		{"other secret", sign(other, map[string]interface{}{"sub": "alice"}), "invalid token signature"},
+		{"other issuer", sign(config, map[string]interface{}{"iss": "https://evil.example"}), "token issued by"},
+		{"tampered claims", parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"root"}`)) + "." + parts[2], "invalid token signature"},
+		{"alg none", none, "unsupported token"},
+		{"malformed", "abc.def", "malformed token"},
+	}
+	for _, tt := range tests {
+		claims, err := verifyJWT(config, tt.token)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		case tt.err == "" && claims["sub"] != "alice":
+			t.Errorf("%s: sub = %v, want alice", tt.name, claims["sub"])
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("%s: error = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestMatchAuthPath(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"*", "/anything/at/all", true},
+		{"/orders", "/orders", true},
+		{"/orders", "/orders/1", false},
+		{"/admin/*", "/admin", true},
+		{"/admin/*", "/admin/users/1", true},
+		{"/admin/*", "/administrator", false},
+		{"/users/{id}", "/users/42", true},
+		{"/users/{id}", "/users/42/posts", false},
+		{"/users/{id}/posts", "/users/42/posts", true},
+		{"/graphql", "/graphql", true},
+	}
+	for _, tt := range tests {
+		if got := matchAuthPath(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("matchAuthPath(%q, %q) = %v, want %v", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestLoadOrCreateSecret(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "goeasyjson", authSecretName)
+	first, err := loadOrCreateSecret(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(first) != 64 {
+		t.Errorf("secret %q, want 32 random bytes in hex", first)
+	}
+	if info, err := os.Stat(file); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("secret file %v, %v, want mode 0600", info, err)
+	}
+	if again, err := loadOrCreateSecret(file); err != nil || again != first {
+		t.Errorf("second run got %q, %v, want the saved %q", again, err, first)
+	}
+}
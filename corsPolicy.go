@@ -0,0 +1,212 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// corsPolicy says which browser origins may call a route. The global policy
+// comes from the -cors flags, a route overrides it with the "cors" object of
+// its .rules.json file:
+//
+//	{"cors": {"origins": ["https://*.example.com"], "credentials": true, "exposeHeaders": ["X-Total-Count"]}, "rules": [...]}
+type corsPolicy struct {
+	Origins       []string `json:"origins,omitempty"` // "*", exact origins or wildcards such as http://localhost:*
+	Methods       []string `json:"methods,omitempty"`
+	Headers       []string `json:"headers,omitempty"` // empty allows the headers the preflight asks for
+	ExposeHeaders []string `json:"exposeHeaders,omitempty"`
+	Credentials   *bool    `json:"credentials,omitempty"`
+	MaxAge        string   `json:"maxAge,omitempty"` // e.g. 10m
+}
+
+// globalCORS is the policy of the -cors flags, nil without -cors.
+func globalCORS() *corsPolicy {
+	if corsOrigins == "" {
+		return nil
+	}
+	return &corsPolicy{
+		Origins:       splitList(corsOrigins),
+		Methods:       splitList(corsMethods),
+		Headers:       splitList(corsHeaders),
+		ExposeHeaders: splitList(corsExpose),
+		Credentials:   &corsCredentials,
+		MaxAge:        corsMaxAge.String(),
+	}
+}
+
+// routeCORS returns the policy of the route serving path: the global policy
+// with the fields set by the rules file of the route, nil for the admin API.
+func routeCORS(path string) *corsPolicy {
+	if adminPath(path) {
+		return nil // the admin API and /ws are never shared with other sites
+	}
+	policy := globalCORS()
+	file, ok := fileForPath(path)
+	if !ok {
+		return policy
+	}
+	rules, err := loadMockRules(file)
+	if err != nil || rules == nil || rules.CORS == nil {
+		return policy
+	}
+	if policy == nil {
+		policy = &corsPolicy{Methods: splitList(corsMethods), ExposeHeaders: splitList(corsExpose), MaxAge: corsMaxAge.String()}
+	}
+	merged := *policy
+	route := rules.CORS
+	if route.Origins != nil {
+		merged.Origins = route.Origins
+	}
+	if route.Methods != nil {
+		merged.Methods = route.Methods
+	}
+	if route.Headers != nil {
+		merged.Headers = route.Headers
+	}
+	if route.ExposeHeaders != nil {
+		merged.ExposeHeaders = route.ExposeHeaders
+	}
+	if route.Credentials != nil {
+		merged.Credentials = route.Credentials
+	}
+	if route.MaxAge != "" {
+		merged.MaxAge = route.MaxAge
+	}
+	return &merged
+}
+
+// fileForPath returns the file of the route serving a request path, also
+// for its /stream and parameterised routes.
+func fileForPath(path string) (string, bool) {
+	_, file, ok := servingRoute(path)
+	return file, ok
+}
+
+// servingRoute returns the route serving a request path and its file.
+func servingRoute(path string) (string, string, bool) {
+	routesLock.RLock()
+	route := path
+	file, ok := routeFiles[route]
+	if !ok {
+		route = strings.TrimSuffix(path, streamSuffix)
+		file, ok = routeFiles[route]
+	}
+	routesLock.RUnlock()
+	if ok {
+		return route, file, true
+	}
+	if pattern, _, found := findRoutePattern(path); found {
+		routesLock.RLock()
+		defer routesLock.RUnlock()
+		file, ok = routeFiles[pattern.route]
+		return pattern.route, file, ok
+	}
+	return "", "", false
+}
+
+// allows reports whether origin matches one of the allowed origins.
+func (p *corsPolicy) allows(origin string) bool {
+	for _, allowed := range p.Origins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+		if strings.Contains(allowed, "*") {
+			pattern := "^" + strings.ReplaceAll(regexp.QuoteMeta(allowed), `\*`, `[^/]*`) + "$"
+			if matched, _ := regexp.MatchString("(?i)"+pattern, origin); matched {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (p *corsPolicy) credentials() bool {
+	return p.Credentials != nil && *p.Credentials
+}
+
+// handleCORS adds the Access-Control headers of the route policy to responses
+// for allowed origins and answers preflight requests itself, for every route
+// whatever methods it serves.
+func handleCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		policy := routeCORS(r.URL.Path)
+		if policy == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		w.Header().Add("Vary", "Origin")
+		if !policy.allows(origin) {
+			if preflight {
+				log.Printf("CORS preflight of %s for %s refused", origin, r.URL.Path)
+				Lg.Warnf("CORS preflight of %s for %s refused", origin, r.URL.Path)
+				w.WriteHeader(http.StatusNoContent) // without Access-Control headers the browser blocks the request
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		allowOrigin := origin
+		if containsFold(policy.Origins, "*") && !policy.credentials() {
+			allowOrigin = "*"
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+		if policy.credentials() {
+			w.Header().Set("Access-Control-Allow-Credentials", "true")
+		}
+		if !preflight {
+			if len(policy.ExposeHeaders) > 0 {
+				w.Header().Set("Access-Control-Expose-Headers", strings.Join(policy.ExposeHeaders, ", "))
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		w.Header().Set("Access-Control-Allow-Methods", strings.Join(policy.Methods, ", "))
+		if len(policy.Headers) > 0 {
+			w.Header().Set("Access-Control-Allow-Headers", strings.Join(policy.Headers, ", "))
+		} else if requested := r.Header.Get("Access-Control-Request-Headers"); requested != "" {
+			w.Header().Set("Access-Control-Allow-Headers", requested)
+		}
+		if maxAge, err := time.ParseDuration(policy.MaxAge); err == nil && maxAge > 0 {
+			w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(maxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// sameHostOrigin reports whether the Origin of r is a page of this server.
+func sameHostOrigin(r *http.Request) bool {
+	u, err := url.Parse(r.Header.Get("Origin"))
+	return err == nil && u.Host != "" && strings.EqualFold(u.Host, r.Host)
+}
+
+// checkWebSocketOrigin accepts WebSocket connections from the same host, and
+// from the origins allowed by the CORS policy of the route. Browsers do not
+// apply CORS to WebSockets, so without a policy other origins are refused:
+// any page the user visits could otherwise read the request log of /ws,
+// which only pages of the server itself may open.
+func checkWebSocketOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" || sameHostOrigin(r) {
+		return true
+	}
+	if policy := routeCORS(r.URL.Path); policy != nil && policy.allows(origin) {
+		return true
+	}
+	Lg.Warnf("WebSocket connection from %s to %s refused, allow the origin with -cors", origin, r.URL.Path)
+	return false
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCORSPolicyAllows(t *testing.T) {
+	tests := []struct {
+		origins []string
+		origin  string
+		want    bool
+	}{
+		{[]string{"*"}, "https://any.example.com", true},
+		{[]string{"https://app.example.com"}, "https://app.example.com", true},
+		{[]string{"https://app.example.com"}, "HTTPS://APP.EXAMPLE.COM", true},
+		{[]string{"https://app.example.com"}, "https://app.example.com:8443", false},
+		{[]string{"https://*.example.com"}, "https://api.example.com", true},
+		{[]string{"https://*.example.com"}, "https://example.com", false},
+		{[]string{"https://*.example.com"}, "https://evil.com/.example.com", false},
+		{[]string{"http://localhost:*"}, "http://localhost:3000", true},
+		{[]string{"http://localhost:*"}, "http://localhost.evil.com", false},
+		{[]string{"http://a.test", "http://b.test"}, "http://b.test", true},
+		{nil, "http://a.test", false},
+	}
+	for _, tt := range tests {
+		policy := &corsPolicy{Origins: tt.origins}
+		if got := policy.allows(tt.origin); got != tt.want {
+			t.Errorf("%v allows %q = %v, want %v", tt.origins, tt.origin, got, tt.want)
+		}
+	}
+}
+
+func TestAdminPathsHaveNoCORSPolicy(t *testing.T) {
+	saved := corsOrigins
+	t.Cleanup(func() { corsOrigins = saved })
+	corsOrigins = "*"
+
+	for _, path := range []string{"/__admin/files", "/__admin/generator/save", "/ws"} {
+		if policy := routeCORS(path); policy != nil {
+			t.Errorf("routeCORS(%q) = %+v, want nil", path, policy)
+		}
+	}
+	r := httptest.NewRequest(http.MethodGet, "http://localhost:8080/ws", nil)
+	r.Header.Set("Origin", "https://evil.example")
+	if checkWebSocketOrigin(r) {
+		t.Error("/ws accepted another site allowed by -cors")
+	}
+	r.Header.Set("Origin", "http://localhost:8080")
+	if !checkWebSocketOrigin(r) {
+		t.Error("/ws refused the Web UI")
+	}
+}
@@ -0,0 +1,520 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/gorilla/mux"
+)
+
+// exportFormats maps the export formats to their default file names.
+var exportFormats = map[string]string{
+	"postman": "goeasyjson.postman_collection.json",
+	"har":     "goeasyjson.har",
+	"openapi": "goeasyjson.openapi.json",
+	"curl":    "goeasyjson.sh",
+}
+
+// exportExample is a request of an exported route with the response the mock
+// gives: the route file, or the file or body of one of its rules.
+type exportExample struct {
+	Name            string
+	Route           string
+	Method          string
+	Path            []string          // segments, parameters keep their {name}
+	PathValues      map[string]string // example values of the parameters
+	Query           [][2]string
+	Headers         [][2]string
+	Status          int
+	ResponseHeaders map[string]string
+	Body            []byte
+}
+
+// runExport implements `goeasyjson export postman|har|openapi|curl [options]`,
+// it describes the routes of the served folder without starting the server.
+func runExport(args []string) int {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	dir := fs.String("dir", ".", "Folder served by GoEasyJson")
+	output := fs.String("out", "", "File to write, - for the standard output (default goeasyjson.<format>)")
+	baseURL := fs.String("base-url", "", "URL the exported requests are sent to (default http(s)://localhost:<port>)")
+	fs.StringVar(&samplesDir, "samples", samplesDir, "Folder of *.sample.json files served as endpoints generating fresh fake data")
+	fs.IntVar(&port, "port", port, "Port of the GoEasyJson server")
+	fs.BoolVar(&tlsEnabled, "tls", false, "The GoEasyJson server speaks HTTPS")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: goeasyjson export postman|har|openapi|curl [options]")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return 2
+	}
+	format := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if _, ok := exportFormats[format]; !ok || fs.NArg() != 0 {
+		fs.Usage()
+		return 2
+	}
+	if *output == "" {
+		*output = exportFormats[format]
+	}
+	if *output != "-" {
+		if abs, err := filepath.Abs(*output); err == nil {
+			*output = abs // relative to where the command runs, not to -dir
+		}
+	}
+	if *baseURL == "" {
+		*baseURL = serverURL()
+	}
+	if err := os.Chdir(*dir); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	found, err := collectRoutes()
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	routesLock.Lock()
+	for route, file := range found {
+		routes[route] = true
+		routeFiles[route] = file
+	}
+	routesLock.Unlock()
+
+	data, err := exportMocks(format, strings.TrimSuffix(*baseURL, "/"), strings.HasSuffix(*output, ".yaml") || strings.HasSuffix(*output, ".yml"))
+	if err != nil {
+		fmt.Printf("Cannot export: %v\n", err)
+		return 1
+	}
+	if *output == "-" {
+		os.Stdout.Write(data)
+		return 0
+	}
+	if err := ioutil.WriteFile(*output, data, 0644); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	fmt.Println(LightGreen.Render(fmt.Sprintf("Exported %d routes of %s to %s.", len(found), *dir, *output)))
+	return 0
+}
+
+// handleExport downloads the current routes from the Web UI, e.g.
+// /__admin/export?format=postman.
+func handleExport(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	name, ok := exportFormats[format]
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, "format must be postman, har, openapi or curl")
+		return
+	}
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	data, err := exportMocks(format, scheme+"://"+r.Host, false)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if format == "curl" {
+		w.Header().Set("Content-Type", "text/x-shellscript; charset=utf-8")
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set("Content-Disposition", `attachment; filename="`+name+`"`)
+	w.Write(data)
+}
+
+func registerExportAdmin(admin *mux.Router) {
+	admin.HandleFunc("/export", handleExport).Methods("GET")
+}
+
+// exportMocks writes the current routes in format.
+func exportMocks(format, baseURL string, asYAML bool) ([]byte, error) {
+	switch format {
+	case "openapi":
+		doc := buildOpenAPIDocument()
+		doc["servers"] = []map[string]string{{"url": baseURL}}
+		if asYAML {
+			data, err := json.Marshal(doc)
+			if err != nil {
+				return nil, err
+			}
+			return yaml.JSONToYAML(data)
+		}
+		return json.MarshalIndent(doc, "", "  ")
+	case "postman":
+		return json.MarshalIndent(postmanCollection(exportRoutes(), baseURL), "", "  ")
+	case "har":
+		return json.MarshalIndent(harArchive(exportRoutes(), baseURL), "", "  ")
+	case "curl":
+		return curlScript(exportRoutes(), baseURL), nil
+	}
+	return nil, fmt.Errorf("unknown export format %q", format)
+}
+
+// exportRoutes lists the examples of every HTTP route, WebSocket routes are
+// left out as the formats only describe HTTP requests.
+func exportRoutes() []exportExample {
+	var examples []exportExample
+	for _, info := range routeInfos() {
+		if info.Kind == "websocket" {
+			continue
+		}
+		base := exportExample{
+			Name:       "GET " + info.Route,
+			Route:      info.Route,
+			Method:     http.MethodGet,
+			Path:       strings.Split(strings.TrimPrefix(openAPIRoute(info.Route), "/"), "/"),
+			PathValues: map[string]string{},
+			Status:     http.StatusOK,
+		}
+		for _, name := range routeParameters(info.Route) {
+			base.PathValues[name] = "1"
+		}
+		base.ResponseHeaders = map[string]string{"Content-Type": "application/json"}
+		base.Body = exampleBody(info)
+		examples = append(examples, base.rendered())
+
+		rules, err := loadMockRules(info.File)
+		if err != nil || rules == nil {
+			continue
+		}
+		for _, rule := range rules.Rules {
+			example, ok := ruleExample(base, rule)
+			if ok && !example.sameAs(base) {
+				examples = append(examples, example.rendered())
+			}
+		}
+	}
+	return examples
+}
+
+// exampleBody is the response of a plain GET: the route file, or records
+// shaped like the sample of a sample route.
+func exampleBody(info RouteInfo) []byte {
+	if info.Kind == "sample" {
+		template, err := loadSampleTemplate(info.File)
+		if err != nil {
+			return nil
+		}
+		records, err := generateWindow(template, sampleWindow{Limit: maxExampleItems, Seed: 1})
+		if err != nil {
+			return nil
+		}
+		data, _ := json.MarshalIndent(records, "", "  ")
+		return data
+	}
+	data, _ := ioutil.ReadFile(info.File)
+	return data
+}
+
+// ruleExample is a request matching rule with its response. Matchers of any
+// value or regexes get a placeholder value, body matchers are not replayed.
+func ruleExample(base exportExample, rule mockRule) (exportExample, bool) {
+	example := base
+	if rule.Method != "" {
+		example.Method = strings.ToUpper(rule.Method)
+	}
+	example.Name = example.Method + " " + base.Route + " (" + rule.Name + ")"
+	example.PathValues = map[string]string{}
+	for name, value := range base.PathValues {
+		example.PathValues[name] = value
+	}
+	for name, expected := range rule.Match.Path {
+		example.PathValues[name] = exampleMatchValue(expected)
+	}
+	for _, name := range sortedKeys(rule.Match.Query) {
+		example.Query = append(example.Query, [2]string{name, exampleMatchValue(rule.Match.Query[name])})
+	}
+	for _, name := range sortedKeys(rule.Match.Headers) {
+		example.Headers = append(example.Headers, [2]string{name, exampleMatchValue(rule.Match.Headers[name])})
+	}
+	var cookies []string
+	for _, name := range sortedKeys(rule.Match.Cookies) {
+		cookies = append(cookies, name+"="+exampleMatchValue(rule.Match.Cookies[name]))
+	}
+	if len(cookies) > 0 {
+		example.Headers = append(example.Headers, [2]string{"Cookie", strings.Join(cookies, "; ")})
+	}
+
+	if rule.Status != 0 {
+		example.Status = rule.Status
+	} else if example.Method == http.MethodPost {
+		example.Status = http.StatusCreated
+	}
+	example.ResponseHeaders = map[string]string{"Content-Type": "application/json", ruleHeader: rule.Name}
+	for name, value := range rule.Headers {
+		example.ResponseHeaders[name] = value
+	}
+	switch {
+	case rule.File != "":
+		data, err := ioutil.ReadFile(rule.File)
+		if err != nil {
+			return example, false
+		}
+		example.Body = data
+	case rule.Body != nil:
+		example.Body, _ = json.MarshalIndent(rule.Body, "", "  ")
+	case example.Method != http.MethodGet:
+		example.Body = nil // the request body is echoed
+	}
+	return example, true
+}
+
+func exampleMatchValue(expected interface{}) string {
+	if s, ok := expected.(string); ok && s != "*" {
+		return s
+	}
+	return "example"
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// sameAs reports whether e repeats the request and response of other, as a
+// recorded rule of the plain GET does.
+func (e exportExample) sameAs(other exportExample) bool {
+	return e.Method == other.Method && e.requestURL("") == other.requestURL("") &&
+		len(e.Headers) == len(other.Headers) && e.Status == other.Status && bytes.Equal(e.Body, other.Body)
+}
+
+// rendered fills the {{path.id}} placeholders of the files of parameterised
+// routes with the values of the example request.
+func (e exportExample) rendered() exportExample {
+	if !isPatternRoute(e.Route) || !bytes.Contains(e.Body, []byte("{{")) {
+		return e
+	}
+	var template interface{}
+	if json.Unmarshal(e.Body, &template) != nil {
+		return e
+	}
+	query := map[string]string{}
+	for _, q := range e.Query {
+		query[q[0]] = q[1]
+	}
+	headers := map[string]string{}
+	for _, h := range e.Headers {
+		headers[strings.ToLower(h[0])] = h[1]
+	}
+	values := map[string]interface{}{
+		"query": query, "headers": headers, "cookies": map[string]string{},
+		"path": e.PathValues, "body": nil, "method": e.Method,
+	}
+	if data, err := json.MarshalIndent(newTemplateContext(values).renderTemplate(template), "", "  "); err == nil {
+		e.Body = data
+	}
+	return e
+}
+
+// requestPath is the path of the example with its parameter values.
+func (e exportExample) requestPath() string {
+	segments := make([]string, len(e.Path))
+	for i, segment := range e.Path {
+		if strings.HasPrefix(segment, "{") {
+			segment = url.PathEscape(e.PathValues[strings.Trim(segment, "{}")])
+		}
+		segments[i] = segment
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// rawQuery is the query string of the example.
+func (e exportExample) rawQuery() string {
+	values := make([]string, len(e.Query))
+	for i, q := range e.Query {
+		values[i] = url.QueryEscape(q[0]) + "=" + url.QueryEscape(q[1])
+	}
+	return strings.Join(values, "&")
+}
+
+func (e exportExample) requestURL(baseURL string) string {
+	u := baseURL + e.requestPath()
+	if query := e.rawQuery(); query != "" {
+		u += "?" + query
+	}
+	return u
+}
+
+// postmanCollection writes the examples as a Postman v2.1 collection, one
+// request per route and method with the responses as saved examples.
+func postmanCollection(examples []exportExample, baseURL string) map[string]interface{} {
+	var items []map[string]interface{}
+	index := map[string]int{}
+	for _, e := range examples {
+		request := postmanExportRequest(e)
+		key := e.Method + " " + e.Route
+		i, ok := index[key]
+		if !ok {
+			i = len(items)
+			index[key] = i
+			items = append(items, map[string]interface{}{"name": key, "request": request, "response": []interface{}{}})
+		}
+		var headers []map[string]string
+		for _, name := range sortedKeys(e.ResponseHeaders) {
+			headers = append(headers, map[string]string{"key": name, "value": e.ResponseHeaders[name]})
+		}
+		items[i]["response"] = append(items[i]["response"].([]interface{}), map[string]interface{}{
+			"name":                     e.Name,
+			"originalRequest":          request,
+			"status":                   http.StatusText(e.Status),
+			"code":                     e.Status,
+			"_postman_previewlanguage": "json",
+			"header":                   headers,
+			"body":                     string(e.Body),
+		})
+	}
+	return map[string]interface{}{
+		"info": map[string]interface{}{
+			"name":        "GoEasyJson mock API",
+			"description": "Exported by GoEasyJson " + CurrentVersion + " with the responses of the mock as examples.",
+			"schema":      "https://schema.getpostman.com/json/collection/v2.1.0/collection.json",
+		},
+		"item":     items,
+		"variable": []map[string]string{{"key": "baseUrl", "value": baseURL}},
+	}
+}
+
+func postmanExportRequest(e exportExample) map[string]interface{} {
+	path := make([]string, len(e.Path))
+	var variables []map[string]string
+	for i, segment := range e.Path {
+		if strings.HasPrefix(segment, "{") {
+			name := strings.Trim(segment, "{}")
+			segment = ":" + name
+			variables = append(variables, map[string]string{"key": name, "value": e.PathValues[name]})
+		}
+		path[i] = segment
+	}
+	raw := "{{baseUrl}}/" + strings.Join(path, "/")
+	var query []map[string]string
+	for _, q := range e.Query {
+		query = append(query, map[string]string{"key": q[0], "value": q[1]})
+	}
+	if len(e.Query) > 0 {
+		raw += "?" + e.rawQuery()
+	}
+	var headers []map[string]string
+	for _, h := range e.Headers {
+		headers = append(headers, map[string]string{"key": h[0], "value": h[1]})
+	}
+	u := map[string]interface{}{"raw": raw, "host": []string{"{{baseUrl}}"}, "path": path}
+	if query != nil {
+		u["query"] = query
+	}
+	if variables != nil {
+		u["variable"] = variables
+	}
+	request := map[string]interface{}{"method": e.Method, "header": headers, "url": u}
+	if headers == nil {
+		request["header"] = []interface{}{}
+	}
+	if e.Method != http.MethodGet {
+		request["body"] = map[string]interface{}{"mode": "raw", "raw": "{}", "options": map[string]interface{}{"raw": map[string]string{"language": "json"}}}
+	}
+	return request
+}
+
+// harArchive writes the examples as HTTP Archive entries.
+func harArchive(examples []exportExample, baseURL string) map[string]interface{} {
+	started := time.Now().UTC().Format(time.RFC3339)
+	nameValues := func(pairs [][2]string) []map[string]string {
+		list := []map[string]string{}
+		for _, p := range pairs {
+			list = append(list, map[string]string{"name": p[0], "value": p[1]})
+		}
+		return list
+	}
+	var entries []map[string]interface{}
+	for _, e := range examples {
+		request := map[string]interface{}{
+			"method": e.Method, "url": e.requestURL(baseURL), "httpVersion": "HTTP/1.1",
+			"headers": nameValues(e.Headers), "queryString": nameValues(e.Query), "cookies": []interface{}{},
+			"headersSize": -1, "bodySize": -1,
+		}
+		if e.Method != http.MethodGet {
+			request["postData"] = map[string]string{"mimeType": "application/json", "text": "{}"}
+		}
+		var headers [][2]string
+		for _, name := range sortedKeys(e.ResponseHeaders) {
+			headers = append(headers, [2]string{name, e.ResponseHeaders[name]})
+		}
+		entries = append(entries, map[string]interface{}{
+			"startedDateTime": started,
+			"time":            0,
+			"request":         request,
+			"response": map[string]interface{}{
+				"status": e.Status, "statusText": http.StatusText(e.Status), "httpVersion": "HTTP/1.1",
+				"headers": nameValues(headers), "cookies": []interface{}{},
+				"content":     map[string]interface{}{"size": len(e.Body), "mimeType": "application/json", "text": string(e.Body)},
+				"redirectURL": "", "headersSize": -1, "bodySize": len(e.Body),
+			},
+			"cache":   map[string]interface{}{},
+			"timings": map[string]int{"send": 0, "wait": 0, "receive": 0},
+			"comment": e.Name,
+		})
+	}
+	return map[string]interface{}{"log": map[string]interface{}{
+		"version": "1.2",
+		"creator": map[string]string{"name": "GoEasyJson", "version": CurrentVersion},
+		"entries": entries,
+	}}
+}
+
+// curlScript writes the examples as a shell script of curl calls, each one
+// preceded by the response it gets as a comment.
+func curlScript(examples []exportExample, baseURL string) []byte {
+	var b bytes.Buffer
+	b.WriteString("#!/bin/sh\n")
+	b.WriteString("# GoEasyJson mock API, exported by GoEasyJson " + CurrentVersion + ".\n")
+	b.WriteString("# Run with BASE_URL=http://host:port sh " + exportFormats["curl"] + " to call another server.\n")
+	b.WriteString("BASE_URL=\"${BASE_URL:-" + baseURL + "}\"\n")
+	for _, e := range examples {
+		b.WriteString("\n# " + e.Name + ": " + strconv.Itoa(e.Status) + " " + http.StatusText(e.Status) + "\n")
+		for i, line := range strings.Split(strings.TrimSpace(string(e.Body)), "\n") {
+			if i == 20 {
+				b.WriteString("#   ...\n")
+				break
+			}
+			if line != "" {
+				b.WriteString("#   " + line + "\n")
+			}
+		}
+		b.WriteString("curl -sS -X " + e.Method + " \"$BASE_URL\"" + shellQuote(e.requestURL("")))
+		for _, h := range e.Headers {
+			b.WriteString(" -H " + shellQuote(h[0]+": "+h[1]))
+		}
+		if e.Method != http.MethodGet {
+			b.WriteString(" -H 'Content-Type: application/json' -d '{}'")
+		}
+		b.WriteString("\necho\n")
+	}
+	return b.Bytes()
+}
+
+// shellQuote quotes s for a POSIX shell.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,593 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+// FakeGenerator fills sample JSON structures with fake data. It keeps the state
+// shared between records: unique values per field, auto-increment sequences
+// and the fake identity used by the correlated fields of the current record.
+type FakeGenerator struct {
+	Faker     *gofakeit.Faker
+	Unique    map[string]bool      // lowercase field names whose values must not repeat
+	Sequences map[string]*Sequence // lowercase field names generated as auto-increment integers
+	Correlate bool                 // name/email/username and city/state/country/zip share one identity
+	Overrides map[string]string    // field path (e.g. "worker[].email") -> rule name chosen by the user
+
+	seen     map[string]map[string]bool
+	identity *fakeIdentity
+	attempt  int
+}
+
+// Sequence is an auto-increment integer generator.
+type Sequence struct {
+	Start int64
+	Step  int64
+	next  int64
+	used  bool
+}
+
+// Next returns the next value of the sequence.
+func (s *Sequence) Next() int64 {
+	if !s.used {
+		s.next = s.Start
+		s.used = true
+	}
+	v := s.next
+	s.next += s.Step
+	return v
+}
+
+// fakeIdentity holds the values of one fake person so that all related fields
+// of a record describe the same person living at the same place.
+type fakeIdentity struct {
+	FirstName string
+	LastName  string
+	Username  string
+	Email     string
+	Street    string
+	Location  fakeLocation
+	Zip       string
+	Latitude  float64
+	Longitude float64
+}
+
+// fakeLocation is a real city with its state, country and postcode pattern.
+// In ZipPattern '#' is replaced by a digit and '?' by an upper-case letter.
+type fakeLocation struct {
+	City       string
+	State      string
+	Country    string
+	ZipPattern string
+	Latitude   float64
+	Longitude  float64
+}
+
+var fakeLocations = []fakeLocation{
+	{"New York", "New York", "United States", "100##", 40.7128, -74.0060},
+	{"Los Angeles", "California", "United States", "900##", 34.0522, -118.2437},
+	{"San Francisco", "California", "United States", "941##", 37.7749, -122.4194},
+	{"Chicago", "Illinois", "United States", "606##", 41.8781, -87.6298},
+	{"Houston", "Texas", "United States", "770##", 29.7604, -95.3698},
+	{"Phoenix", "Arizona", "United States", "850##", 33.4484, -112.0740},
+	{"Seattle", "Washington", "United States", "981##", 47.6062, -122.3321},
+	{"Boston", "Massachusetts", "United States", "021##", 42.3601, -71.0589},
+	{"Miami", "Florida", "United States", "331##", 25.7617, -80.1918},
+	{"Denver", "Colorado", "United States", "802##", 39.7392, -104.9903},
+	{"London", "England", "United Kingdom", "SW# #??", 51.5074, -0.1278},
+	{"Manchester", "England", "United Kingdom", "M## #??", 53.4808, -2.2426},
+	{"Toronto", "Ontario", "Canada", "M#? #?#", 43.6532, -79.3832},
+	{"Vancouver", "British Columbia", "Canada", "V#? #?#", 49.2827, -123.1207},
+	{"Berlin", "Berlin", "Germany", "10###", 52.5200, 13.4050},
+	{"Munich", "Bavaria", "Germany", "80###", 48.1351, 11.5820},
+	{"Paris", "Île-de-France", "France", "750##", 48.8566, 2.3522},
+	{"Lyon", "Auvergne-Rhône-Alpes", "France", "690##", 45.7640, 4.8357},
+	{"Shenzhen", "Guangdong", "China", "518###", 22.5431, 114.0579},
+	{"Beijing", "Beijing", "China", "100###", 39.9042, 116.4074},
+	{"Shanghai", "Shanghai", "China", "200###", 31.2304, 121.4737},
+	{"Tokyo", "Tokyo", "Japan", "1##-####", 35.6762, 139.6503},
+	{"Sydney", "New South Wales", "Australia", "20##", -33.8688, 151.2093},
+	{"Melbourne", "Victoria", "Australia", "30##", -37.8136, 144.9631},
+}
+
+var fakeEmailDomains = []string{"gmail.com", "outlook.com", "yahoo.com", "hotmail.com", "icloud.com", "proton.me"}
+
+// fakeRule produces the value of one generator rule.
+type fakeRule func(g *FakeGenerator) interface{}
+
+// fakeRules maps generator rule names to their value functions.
+var fakeRules = map[string]fakeRule{
+	"name":          func(g *FakeGenerator) interface{} { id := g.person(); return id.FirstName + " " + id.LastName },
+	"firstname":     func(g *FakeGenerator) interface{} { return g.person().FirstName },
+	"lastname":      func(g *FakeGenerator) interface{} { return g.person().LastName },
+	"username":      func(g *FakeGenerator) interface{} { return g.withAttempt(g.person().Username) },
+	"email":         func(g *FakeGenerator) interface{} { return g.emailWithAttempt(g.person().Email) },
+	"gender":        func(g *FakeGenerator) interface{} { return g.Faker.Gender() },
+	"address":       func(g *FakeGenerator) interface{} { return g.fullAddress() },
+	"phone":         func(g *FakeGenerator) interface{} { return g.Faker.Phone() },
+	"city":          func(g *FakeGenerator) interface{} { return g.person().Location.City },
+	"country":       func(g *FakeGenerator) interface{} { return g.person().Location.Country },
+	"state":         func(g *FakeGenerator) interface{} { return g.person().Location.State },
+	"street":        func(g *FakeGenerator) interface{} { return g.person().Street },
+	"zipcode":       func(g *FakeGenerator) interface{} { return g.person().Zip },
+	"company":       func(g *FakeGenerator) interface{} { return g.Faker.Company() },
+	"jobtitle":      func(g *FakeGenerator) interface{} { return g.Faker.JobTitle() },
+	"date":          func(g *FakeGenerator) interface{} { return g.Faker.Date().Format("2006-01-02") },
+	"datetime":      func(g *FakeGenerator) interface{} { return g.Faker.Date().Format(time.RFC3339) },
+	"url":           func(g *FakeGenerator) interface{} { return g.Faker.URL() },
+	"color":         func(g *FakeGenerator) interface{} { return g.Faker.Color() },
+	"uuid":          func(g *FakeGenerator) interface{} { return g.Faker.UUID() },
+	"latitude":      func(g *FakeGenerator) interface{} { return g.person().Latitude },
+	"longitude":     func(g *FakeGenerator) interface{} { return g.person().Longitude },
+	"word":          func(g *FakeGenerator) interface{} { return g.Faker.Word() },
+	"sentence":      func(g *FakeGenerator) interface{} { return g.Faker.Sentence() },
+	"paragraph":     func(g *FakeGenerator) interface{} { return g.Faker.Paragraph() },
+	"creditcard":    func(g *FakeGenerator) interface{} { return g.Faker.CreditCard().Number },
+	"cardtype":      func(g *FakeGenerator) interface{} { return g.Faker.CreditCardType() },
+	"cardexp":       func(g *FakeGenerator) interface{} { return g.Faker.CreditCardExp() },
+	"cardholder":    func(g *FakeGenerator) interface{} { id := g.person(); return id.FirstName + " " + id.LastName },
+	"quantity":      func(g *FakeGenerator) interface{} { return g.Faker.IntN(1000000) },
+	"price":         func(g *FakeGenerator) interface{} { return fmt.Sprintf("%.2f", g.Faker.Price(1, 1000)) },
+	"currency":      func(g *FakeGenerator) interface{} { return g.Faker.CurrencyShort() },
+	"ip":            func(g *FakeGenerator) interface{} { return g.Faker.IPv4Address() },
+	"ipv6":          func(g *FakeGenerator) interface{} { return g.Faker.IPv6Address() },
+	"macaddress":    func(g *FakeGenerator) interface{} { return g.Faker.MacAddress() },
+	"password":      func(g *FakeGenerator) interface{} { return g.Faker.Password(true, true, true, true, true, 12) },
+	"day":           func(g *FakeGenerator) interface{} { return g.Faker.Day() },
+	"month":         func(g *FakeGenerator) interface{} { return g.Faker.Month() },
+	"year":          func(g *FakeGenerator) interface{} { return g.Faker.Year() },
+	"companysuffix": func(g *FakeGenerator) interface{} { return g.Faker.CompanySuffix() },
+	"unit":          func(g *FakeGenerator) interface{} { return g.Faker.Unit() },
+	"area":          func(g *FakeGenerator) interface{} { return g.Faker.Float64() * 10000 },
+	"bool":          func(g *FakeGenerator) interface{} { return g.Faker.Bool() },
+}
+
+// fieldRules maps lowercase JSON keys to the generator rule used for string values.
+var fieldRules = map[string]string{
+	"name":                      "name",
+	"fullname":                  "name",
+	"username":                  "username",
+	"firstname":                 "firstname",
+	"lastname":                  "lastname",
+	"email":                     "email",
+	"gender":                    "gender",
+	"address":                   "address",
+	"phone":                     "phone",
+	"telephone":                 "phone",
+	"city":                      "city",
+	"country":                   "country",
+	"state":                     "state",
+	"streetaddress":             "street",
+	"street":                    "street",
+	"zipcode":                   "zipcode",
+	"postcode":                  "zipcode",
+	"zip":                       "zipcode",
+	"company":                   "company",
+	"jobtitle":                  "jobtitle",
+	"title":                     "jobtitle",
+	"date":                      "date",
+	"dob":                       "date",
+	"birthdate":                 "date",
+	"datetime":                  "datetime",
+	"timestamp":                 "datetime",
+	"url":                       "url",
+	"website":                   "url",
+	"color":                     "color",
+	"uuid":                      "uuid",
+	"id":                        "uuid",
+	"latitude":                  "latitude",
+	"longitude":                 "longitude",
+	"word":                      "word",
+	"sentence":                  "sentence",
+	"paragraph":                 "paragraph",
+	"creditcardnumber":          "creditcard",
+	"creditcardtype":            "cardtype",
+	"creditcardexpirationdate":  "cardexp",
+	"creditcardholdername":      "cardholder",
+	"creditcardexpirationmonth": "month",
+	"creditcardexpirationyear":  "year",
+	"quantity":                  "quantity",
+	"price":                     "price",
+	"amount":                    "price",
+	"currency":                  "currency",
+	"ip":                        "ip",
+	"ipv6":                      "ipv6",
+	"macaddress":                "macaddress",
+	"mac":                       "macaddress",
+	"password":                  "password",
+	"day":                       "day",
+	"month":                     "month",
+	"year":                      "year",
+	"companysuffix":             "companysuffix",
+	"unit":                      "unit",
+	"area":                      "area",
+	"rich":                      "bool",
+}
+
+// NewFakeGenerator creates a generator. A seed of 0 means random output,
+// any other seed makes the output reproducible.
+func NewFakeGenerator(seed uint64) *FakeGenerator {
+	return &FakeGenerator{
+		Faker:     gofakeit.New(seed),
+		Unique:    make(map[string]bool),
+		Sequences: make(map[string]*Sequence),
+		Overrides: make(map[string]string),
+		seen:      make(map[string]map[string]bool),
+	}
+}
+
+// ParseUniqueFields parses a comma separated list of field names, e.g. "email,username".
+func ParseUniqueFields(spec string) map[string]bool {
+	fields := make(map[string]bool)
+	for _, f := range strings.Split(spec, ",") {
+		if f = strings.ToLower(strings.TrimSpace(f)); f != "" {
+			fields[f] = true
+		}
+	}
+	return fields
+}
+
+// ParseSequences parses auto-increment definitions in the form field[:start[:step]],
+// separated by commas, e.g. "id:1000:10,orderno". Start and step default to 1.
+func ParseSequences(spec string) (map[string]*Sequence, error) {
+	sequences := make(map[string]*Sequence)
+	for _, def := range strings.Split(spec, ",") {
+		def = strings.TrimSpace(def)
+		if def == "" {
+			continue
+		}
+		parts := strings.Split(def, ":")
+		seq := &Sequence{Start: 1, Step: 1}
+		if len(parts) > 3 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid sequence %q, expected field[:start[:step]]", def)
+		}
+		if len(parts) > 1 {
+			start, err := strconv.ParseInt(parts[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid start in sequence %q: %v", def, err)
+			}
+			seq.Start = start
+		}
+		if len(parts) > 2 {
+			step, err := strconv.ParseInt(parts[2], 10, 64)
+			if err != nil || step == 0 {
+				return nil, fmt.Errorf("invalid step in sequence %q", def)
+			}
+			seq.Step = step
+		}
+		sequences[strings.ToLower(parts[0])] = seq
+	}
+	return sequences, nil
+}
+
+// NewRecord fills a deep copy of sample as one new record.
+func (g *FakeGenerator) NewRecord(sample interface{}) interface{} {
+	g.identity = nil
+	return g.fillDynamic(deepCopyJSON(sample), "", "")
+}
+
+// FieldRule describes how one field of a sample is generated.
+type FieldRule struct {
+	Path    string      `json:"path"`
+	Key     string      `json:"key"`
+	Type    string      `json:"type"`
+	Rule    string      `json:"rule"`
+	Example interface{} `json:"example"`
+}
+
+// DescribeFields lists the scalar fields of sample with the rule that generates them.
+func (g *FakeGenerator) DescribeFields(sample interface{}) []FieldRule {
+	var fields []FieldRule
+	var walk func(v interface{}, key, path string)
+	walk = func(v interface{}, key, path string) {
+		switch vv := v.(type) {
+		case map[string]interface{}:
+			keys := make([]string, 0, len(vv))
+			for k := range vv {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				walk(vv[k], k, joinFieldPath(path, k))
+			}
+		case []interface{}:
+			for _, item := range vv {
+				walk(item, "", path+"[]")
+				break
+			}
+		default:
+			fields = append(fields, FieldRule{
+				Path:    path,
+				Key:     key,
+				Type:    jsonTypeName(v),
+				Rule:    g.ruleAt(path, key, v),
+				Example: v,
+			})
+		}
+	}
+	walk(sample, "", "")
+	return fields
+}
+
+// RuleNames returns the names of all rules that can be chosen for a field.
+func RuleNames() []string {
+	names := []string{"keep", "number", "sequence", "random"}
+	for name := range fakeRules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func joinFieldPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64, int, int64:
+		return "number"
+	}
+	return "unknown"
+}
+
+// ruleAt returns the rule for the field at path, honouring user overrides.
+func (g *FakeGenerator) ruleAt(path, key string, v interface{}) string {
+	if rule, ok := g.Overrides[path]; ok && rule != "" {
+		return rule
+	}
+	return g.RuleFor(key, v)
+}
+
+// RuleFor returns the name of the rule used to generate the value of key,
+// based on the type of the sample value.
+func (g *FakeGenerator) RuleFor(key string, v interface{}) string {
+	lower := strings.ToLower(key)
+	if _, ok := g.Sequences[lower]; ok {
+		return "sequence"
+	}
+	switch v.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	case string:
+		if rule, ok := fieldRules[lower]; ok {
+			return rule
+		}
+		return "word"
+	case bool:
+		return "bool"
+	case float64, int, int8, int16, int32, int64:
+		return "number"
+	}
+	return "random"
+}
+
+func (g *FakeGenerator) fillDynamic(v interface{}, key, path string) interface{} {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		// Sorted keys keep the output reproducible for a given seed.
+		keys := make([]string, 0, len(vv))
+		for k := range vv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			vv[k] = g.fillDynamic(vv[k], k, joinFieldPath(path, k))
+		}
+		return vv
+	case []interface{}:
+		// Every element of an array describes a different entity.
+		outer := g.identity
+		for i, item := range vv {
+			g.identity = nil
+			vv[i] = g.fillDynamic(item, "", path+"[]")
+		}
+		g.identity = outer
+		return vv
+	}
+
+	rule := g.ruleAt(path, key, v)
+	field := strings.ToLower(key)
+	if !g.Unique[field] {
+		return g.generate(rule, v, key)
+	}
+
+	seen := g.seen[field]
+	if seen == nil {
+		seen = make(map[string]bool)
+		g.seen[field] = seen
+	}
+	var value interface{}
+	for g.attempt = 0; g.attempt < 50; g.attempt++ {
+		if g.attempt > 0 {
+			g.identity = nil // a correlated field would repeat the same person
+		}
+		value = g.generate(rule, v, key)
+		if !seen[fmt.Sprint(value)] {
+			break
+		}
+	}
+	if seen[fmt.Sprint(value)] {
+		value = uniqueFallback(value, seen)
+	}
+	g.attempt = 0
+	seen[fmt.Sprint(value)] = true
+	return value
+}
+
+// uniqueFallback returns an unseen value of the same type as value when the
+// rule keeps producing duplicates: numbers are incremented, other values get
+// a -N suffix.
+func uniqueFallback(value interface{}, seen map[string]bool) interface{} {
+	switch n := value.(type) {
+	case int:
+		for seen[fmt.Sprint(n)] {
+			n++
+		}
+		return n
+	case int64:
+		for seen[fmt.Sprint(n)] {
+			n++
+		}
+		return n
+	case float64:
+		for seen[fmt.Sprint(n)] {
+			n++
+		}
+		return n
+	}
+	return fmt.Sprintf("%v-%d", value, len(seen)+1)
+}
+
+// generate produces one value for key using rule, v is the sample value.
+func (g *FakeGenerator) generate(rule string, v interface{}, key string) interface{} {
+	switch rule {
+	case "keep":
+		return v
+	case "sequence":
+		seq, ok := g.Sequences[strings.ToLower(key)]
+		if !ok {
+			seq = &Sequence{Start: 1, Step: 1}
+			g.Sequences[strings.ToLower(key)] = seq
+		}
+		return seq.Next()
+	case "number":
+		return g.randomNumber(v)
+	case "random":
+		// A 7-digit number appended to the key name, from the seeded faker
+		return fmt.Sprintf("%s%d", key, g.Faker.IntRange(1000000, 9999999))
+	}
+	if fn, ok := fakeRules[rule]; ok {
+		return fn(g)
+	}
+	return g.Faker.Word()
+}
+
+// randomNumber returns a random number keeping the decimal places of the sample value.
+func (g *FakeGenerator) randomNumber(v interface{}) interface{} {
+	switch value := v.(type) {
+	case float64:
+		str := strconv.FormatFloat(value, 'f', -1, 64)
+		parts := strings.Split(str, ".")
+		decimalPlaces := 0
+		if len(parts) > 1 {
+			decimalPlaces = len(parts[1])
+		}
+
+		// Random number between 0 and 100
+		randomValue := g.Faker.Float64() * 100
+		if decimalPlaces > 0 {
+			multiplier := math.Pow10(decimalPlaces)
+			return math.Round(randomValue*multiplier) / multiplier
+		}
+		return math.Round(randomValue)
+	case int, int8, int16, int32, int64:
+		// Integer types, generate a random integer with the same number of digits
+		numDigits := len(fmt.Sprintf("%d", value))
+		min := int(math.Pow10(numDigits - 1))
+		max := int(math.Pow10(numDigits)) - 1
+		return g.Faker.IntRange(min, max)
+	default:
+		// The user chose a number for a field that is not numeric in the sample
+		return g.Faker.IntRange(0, 1000)
+	}
+}
+
+// person returns the identity of the current record, creating it on first use.
+// Without correlation every call returns a fresh identity.
+func (g *FakeGenerator) person() *fakeIdentity {
+	if g.identity != nil && g.Correlate {
+		return g.identity
+	}
+	f := g.Faker
+	loc := fakeLocations[f.IntN(len(fakeLocations))]
+	first, last := f.FirstName(), f.LastName()
+	local := strings.ToLower(first + "." + last)
+	local = strings.NewReplacer(" ", "", "'", "").Replace(local)
+	id := &fakeIdentity{
+		FirstName: first,
+		LastName:  last,
+		Username:  strings.ToLower(first[:1]+strings.ReplaceAll(last, " ", "")) + strconv.Itoa(f.IntRange(1, 99)),
+		Email:     local + "@" + fakeEmailDomains[f.IntN(len(fakeEmailDomains))],
+		Street:    f.StreetNumber() + " " + f.StreetName(),
+		Location:  loc,
+		Zip:       g.zipFromPattern(loc.ZipPattern),
+		Latitude:  math.Round((loc.Latitude+f.Float64Range(-0.1, 0.1))*1e6) / 1e6,
+		Longitude: math.Round((loc.Longitude+f.Float64Range(-0.1, 0.1))*1e6) / 1e6,
+	}
+	g.identity = id
+	return id
+}
+
+func (g *FakeGenerator) zipFromPattern(pattern string) string {
+	var b strings.Builder
+	for _, c := range pattern {
+		switch c {
+		case '#':
+			b.WriteByte(byte('0' + g.Faker.IntN(10)))
+		case '?':
+			b.WriteByte(byte('A' + g.Faker.IntN(26)))
+		default:
+			b.WriteRune(c)
+		}
+	}
+	return b.String()
+}
+
+func (g *FakeGenerator) fullAddress() string {
+	id := g.person()
+	return fmt.Sprintf("%s, %s, %s %s, %s", id.Street, id.Location.City, id.Location.State, id.Zip, id.Location.Country)
+}
+
+// withAttempt varies a derived value when a unique field needs another try.
+func (g *FakeGenerator) withAttempt(value string) string {
+	if g.attempt == 0 {
+		return value
+	}
+	return value + strconv.Itoa(g.Faker.IntRange(100, 9999))
+}
+
+func (g *FakeGenerator) emailWithAttempt(email string) string {
+	if g.attempt == 0 {
+		return email
+	}
+	at := strings.LastIndex(email, "@")
+	return g.withAttempt(email[:at]) + email[at:]
+}
+
+// deepCopyJSON copies a value decoded from JSON.
+func deepCopyJSON(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(vv))
+		for k, val := range vv {
+			m[k] = deepCopyJSON(val)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(vv))
+		for i, val := range vv {
+			s[i] = deepCopyJSON(val)
+		}
+		return s
+	}
+	return v
+}
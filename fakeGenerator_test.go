@@ -0,0 +1,114 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestParseSequences(t *testing.T) {
+	sequences, err := ParseSequences("id:1000:10, orderNo ,page:0:-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string][]int64{"id": {1000, 1010, 1020}, "orderno": {1, 2, 3}, "page": {0, -1, -2}}
+	for field, values := range want {
+		seq, ok := sequences[field]
+		if !ok {
+			t.Fatalf("sequence %s missing", field)
+		}
+		for _, v := range values {
+			if got := seq.Next(); got != v {
+				t.Errorf("%s: next = %d, want %d", field, got, v)
+			}
+		}
+	}
+	for _, spec := range []string{"id:x", "id:1:0", "id:1:2:3", ":5"} {
+		if _, err := ParseSequences(spec); err == nil {
+			t.Errorf("ParseSequences(%q) accepted the definition", spec)
+		}
+	}
+}
+
+func TestGeneratorSequenceRecords(t *testing.T) {
+	gen := NewFakeGenerator(1)
+	gen.Sequences, _ = ParseSequences("id:100:5")
+	for i := 0; i < 3; i++ {
+		record := gen.NewRecord(map[string]interface{}{"id": 1.0, "tags": []interface{}{"a"}}).(map[string]interface{})
+		if want := int64(100 + 5*i); record["id"] != want {
+			t.Errorf("record %d: id = %v, want %d", i, record["id"], want)
+		}
+	}
+}
+
+func TestGeneratorSeedIsReproducible(t *testing.T) {
+	sample := map[string]interface{}{"name": "x", "email": "x@y.z", "city": "c", "age": 30.0, "code": nil}
+	a, b := NewFakeGenerator(42), NewFakeGenerator(42)
+	for i := 0; i < 5; i++ {
+		if ra, rb := a.NewRecord(sample), b.NewRecord(sample); !reflect.DeepEqual(ra, rb) {
+			t.Fatalf("record %d differs for the same seed: %v and %v", i, ra, rb)
+		}
+	}
+}
+
+func TestGeneratorUniqueFields(t *testing.T) {
+	suffix := regexp.MustCompile(`-\d+$`)
+	for _, correlate := range []bool{false, true} {
+		gen := NewFakeGenerator(7)
+		gen.Correlate = correlate
+		gen.Unique = ParseUniqueFields("name, Email")
+		names, emails := map[interface{}]bool{}, map[interface{}]bool{}
+		for i := 0; i < 3000; i++ {
+			record := gen.NewRecord(map[string]interface{}{"name": "x", "email": "x@y.z"}).(map[string]interface{})
+			if names[record["name"]] || emails[record["email"]] {
+				t.Fatalf("correlate %v: record %d repeats %v", correlate, i, record)
+			}
+			names[record["name"]], emails[record["email"]] = true, true
+			if suffix.MatchString(fmt.Sprint(record["name"])) {
+				t.Errorf("correlate %v: name %v fell back to a suffix, the retries should find another person", correlate, record["name"])
+			}
+		}
+	}
+}
+
+func TestGeneratorCorrelation(t *testing.T) {
+	sample := map[string]interface{}{"name": "x", "email": "x@y.z", "city": "c", "state": "s", "country": "n"}
+	gen := NewFakeGenerator(3)
+	gen.Correlate = true
+	for i := 0; i < 20; i++ {
+		record := gen.NewRecord(sample).(map[string]interface{})
+		name := strings.ToLower(strings.NewReplacer(" ", ".", "'", "").Replace(record["name"].(string)))
+		if local := strings.Split(record["email"].(string), "@")[0]; !strings.HasPrefix(name, strings.SplitN(local, ".", 2)[0]) {
+			t.Errorf("email %v does not belong to %v", record["email"], record["name"])
+		}
+		found := false
+		for _, loc := range fakeLocations {
+			found = found || (loc.City == record["city"] && loc.State == record["state"] && loc.Country == record["country"])
+		}
+		if !found {
+			t.Errorf("%v, %v, %v is not one place", record["city"], record["state"], record["country"])
+		}
+	}
+	if NewFakeGenerator(3).Correlate {
+		t.Error("correlation must be opted in")
+	}
+}
+
+func TestUniqueFallback(t *testing.T) {
+	seen := map[string]bool{"5": true, "6": true, "a": true}
+	tests := []struct {
+		value, want interface{}
+	}{
+		{5, 7},
+		{int64(5), int64(7)},
+		{5.0, 7.0},
+		{"a", "a-4"},
+	}
+	for _, tt := range tests {
+		if got := uniqueFallback(tt.value, seen); got != tt.want {
+			t.Errorf("uniqueFallback(%#v) = %#v, want %#v", tt.value, got, tt.want)
+		}
+	}
+}
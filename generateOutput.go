@@ -0,0 +1,586 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/goccy/go-yaml"
+	"github.com/parquet-go/parquet-go"
+)
+
+// outputFormats lists the formats supported by the test data generator.
+var outputFormats = map[string]bool{
+	"json":    true,
+	"ndjson":  true,
+	"csv":     true,
+	"sql":     true,
+	"parquet": true,
+	"yaml":    true,
+}
+
+// formatFromFileName guesses the output format from the output file extension.
+func formatFromFileName(fileName string) string {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".ndjson", ".jsonl":
+		return "ndjson"
+	case ".csv":
+		return "csv"
+	case ".sql":
+		return "sql"
+	case ".parquet":
+		return "parquet"
+	case ".yaml", ".yml":
+		return "yaml"
+	}
+	return "json"
+}
+
+// OutputOptions configures how generated records are written.
+type OutputOptions struct {
+	Format    string // json, ndjson, csv, sql, parquet or yaml
+	Dialect   string // SQL dialect: postgres, mysql or sqlite
+	Table     string // SQL table name
+	BatchSize int    // rows per SQL INSERT statement
+}
+
+// writeGeneratedData writes records to outputFile in the requested format.
+func writeGeneratedData(outputFile string, records []interface{}, opts OutputOptions) error {
+	if opts.Format == "" {
+		opts.Format = formatFromFileName(outputFile)
+	}
+	if !outputFormats[opts.Format] {
+		return fmt.Errorf("unsupported output format %q", opts.Format)
+	}
+	if opts.Table == "" {
+		opts.Table = strings.TrimSuffix(filepath.Base(outputFile), filepath.Ext(outputFile))
+	}
+	if opts.Format == "sql" {
+		// Check the options before creating the file, not to leave an empty one behind
+		if _, _, err := sqlDialectOf(opts.Dialect); err != nil {
+			return err
+		}
+		if _, columns := flattenAll(records); len(columns) == 0 {
+			return errNoSQLColumns
+		}
+	}
+
+	file, err := os.Create(outputFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	err = writeRecords(w, records, opts)
+	if err == nil {
+		err = w.Flush()
+	}
+	if err != nil {
+		file.Close()
+		os.Remove(outputFile)
+	}
+	return err
+}
+
+// writeRecords encodes records into w in the requested format.
+func writeRecords(w io.Writer, records []interface{}, opts OutputOptions) error {
+	switch opts.Format {
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, record := range records {
+			if err := enc.Encode(record); err != nil {
+				return err
+			}
+		}
+		return nil
+	case "csv":
+		return writeCSV(w, records)
+	case "sql":
+		return writeSQL(w, records, opts)
+	case "parquet":
+		return writeParquet(w, records)
+	case "yaml":
+		data, err := yaml.Marshal(integralNumbers(records))
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	default:
+		data, err := json.MarshalIndent(records, "", "  ")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	}
+}
+
+// integralNumbers converts whole float64 values decoded from JSON into int64,
+// so YAML output shows 42 instead of 42.0.
+func integralNumbers(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		for k, val := range vv {
+			vv[k] = integralNumbers(val)
+		}
+	case []interface{}:
+		for i, val := range vv {
+			vv[i] = integralNumbers(val)
+		}
+	case float64:
+		if scalarKind(vv) == "int" {
+			return int64(vv)
+		}
+	}
+	return v
+}
+
+// flattenRecord flattens nested objects into dotted keys, e.g. "address.city".
+// Arrays are kept as JSON text and records that are not objects use the key "value".
+func flattenRecord(record interface{}) map[string]interface{} {
+	flat := make(map[string]interface{})
+	if m, ok := record.(map[string]interface{}); ok {
+		flattenInto(flat, "", m)
+	} else {
+		flat["value"] = flatValue(record)
+	}
+	return flat
+}
+
+func flattenInto(flat map[string]interface{}, prefix string, m map[string]interface{}) {
+	for k, v := range m {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+			flattenInto(flat, key, nested)
+			continue
+		}
+		flat[key] = flatValue(v)
+	}
+}
+
+func flatValue(v interface{}) interface{} {
+	switch v.(type) {
+	case map[string]interface{}, []interface{}:
+		data, _ := json.Marshal(v)
+		return string(data)
+	}
+	return v
+}
+
+// flatColumns returns the sorted union of the keys of all flattened records.
+func flatColumns(rows []map[string]interface{}) []string {
+	seen := make(map[string]bool)
+	var columns []string
+	for _, row := range rows {
+		for k := range row {
+			if !seen[k] {
+				seen[k] = true
+				columns = append(columns, k)
+			}
+		}
+	}
+	sort.Strings(columns)
+	return columns
+}
+
+func flattenAll(records []interface{}) ([]map[string]interface{}, []string) {
+	rows := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		rows[i] = flattenRecord(record)
+	}
+	return rows, flatColumns(rows)
+}
+
+// scalarText formats a flattened value as plain text.
+func scalarText(v interface{}) string {
+	switch vv := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return vv
+	case float64:
+		return strconv.FormatFloat(vv, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+func writeCSV(w io.Writer, records []interface{}) error {
+	rows, columns := flattenAll(records)
+	cw := csv.NewWriter(w)
+	if err := cw.Write(columns); err != nil {
+		return err
+	}
+	line := make([]string, len(columns))
+	for _, row := range rows {
+		for i, col := range columns {
+			line[i] = scalarText(row[col])
+		}
+		if err := cw.Write(line); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// sqlDialect describes the differences between the supported SQL databases.
+type sqlDialect struct {
+	quote   func(string) string
+	types   map[string]string
+	boolean func(bool) string
+}
+
+var sqlDialects = map[string]sqlDialect{
+	"postgres": {
+		quote:   func(s string) string { return `"` + strings.ReplaceAll(s, `"`, `""`) + `"` },
+		types:   map[string]string{"int": "BIGINT", "float": "DOUBLE PRECISION", "bool": "BOOLEAN", "string": "TEXT"},
+		boolean: func(b bool) string { return strings.ToUpper(strconv.FormatBool(b)) },
+	},
+	"mysql": {
+		quote:   func(s string) string { return "`" + strings.ReplaceAll(s, "`", "``") + "`" },
+		types:   map[string]string{"int": "BIGINT", "float": "DOUBLE", "bool": "BOOLEAN", "string": "TEXT"},
+		boolean: func(b bool) string { return strings.ToUpper(strconv.FormatBool(b)) },
+	},
+	"sqlite": {
+		quote: func(s string) string { return `"` + strings.ReplaceAll(s, `"`, `""`) + `"` },
+		types: map[string]string{"int": "INTEGER", "float": "REAL", "bool": "INTEGER", "string": "TEXT"},
+		boolean: func(b bool) string {
+			if b {
+				return "1"
+			}
+			return "0"
+		},
+	},
+}
+
+// scalarKind returns int, float, bool or string for a flattened value, "" for null.
+func scalarKind(v interface{}) string {
+	switch vv := v.(type) {
+	case nil:
+		return ""
+	case bool:
+		return "bool"
+	case float64:
+		if vv == math.Trunc(vv) && math.Abs(vv) < 1e15 {
+			return "int"
+		}
+		return "float"
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "int"
+	case float32:
+		return "float"
+	}
+	return "string"
+}
+
+// mergeKinds combines the kinds seen for one column across records.
+func mergeKinds(a, b string) string {
+	switch {
+	case a == "" || a == b:
+		return b
+	case b == "":
+		return a
+	case (a == "int" && b == "float") || (a == "float" && b == "int"):
+		return "float"
+	}
+	return "string"
+}
+
+// errNoSQLColumns is returned for records without fields, a table needs a column.
+var errNoSQLColumns = errors.New("the records have no fields to turn into SQL columns")
+
+// sqlDialectOf returns the dialect of -dialect, postgres by default.
+func sqlDialectOf(name string) (sqlDialect, string, error) {
+	dialectName := strings.ToLower(name)
+	if dialectName == "" {
+		dialectName = "postgres"
+	}
+	dialect, ok := sqlDialects[dialectName]
+	if !ok {
+		return sqlDialect{}, "", fmt.Errorf("unsupported SQL dialect %q (use postgres, mysql or sqlite)", name)
+	}
+	return dialect, dialectName, nil
+}
+
+func writeSQL(w io.Writer, records []interface{}, opts OutputOptions) error {
+	dialect, dialectName, err := sqlDialectOf(opts.Dialect)
+	if err != nil {
+		return err
+	}
+	batch := opts.BatchSize
+	if batch <= 0 {
+		batch = 500
+	}
+
+	rows, columns := flattenAll(records)
+	if len(columns) == 0 {
+		return errNoSQLColumns
+	}
+	kinds := make(map[string]string, len(columns))
+	for _, row := range rows {
+		for _, col := range columns {
+			kinds[col] = mergeKinds(kinds[col], scalarKind(row[col]))
+		}
+	}
+
+	table := dialect.quote(opts.Table)
+	quoted := make([]string, len(columns))
+	definitions := make([]string, len(columns))
+	for i, col := range columns {
+		kind := kinds[col]
+		if kind == "" {
+			kind = "string"
+		}
+		quoted[i] = dialect.quote(col)
+		definitions[i] = "  " + quoted[i] + " " + dialect.types[kind]
+	}
+	if _, err := fmt.Fprintf(w, "CREATE TABLE %s (\n%s\n);\n\n", table, strings.Join(definitions, ",\n")); err != nil {
+		return err
+	}
+
+	for start := 0; start < len(rows); start += batch {
+		end := start + batch
+		if end > len(rows) {
+			end = len(rows)
+		}
+		if _, err := fmt.Fprintf(w, "INSERT INTO %s (%s) VALUES\n", table, strings.Join(quoted, ", ")); err != nil {
+			return err
+		}
+		for i, row := range rows[start:end] {
+			values := make([]string, len(columns))
+			for j, col := range columns {
+				values[j] = sqlLiteral(row[col], kinds[col], dialect, dialectName)
+			}
+			sep := ","
+			if start+i == end-1 {
+				sep = ";"
+			}
+			if _, err := fmt.Fprintf(w, "  (%s)%s\n", strings.Join(values, ", "), sep); err != nil {
+				return err
+			}
+		}
+		if _, err := io.WriteString(w, "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func sqlLiteral(v interface{}, kind string, dialect sqlDialect, dialectName string) string {
+	if v == nil {
+		return "NULL"
+	}
+	if b, ok := v.(bool); ok && kind == "bool" {
+		return dialect.boolean(b)
+	}
+	text := scalarText(v)
+	if kind == "int" || kind == "float" {
+		return text
+	}
+	text = strings.ReplaceAll(text, "'", "''")
+	if dialectName == "mysql" {
+		text = strings.ReplaceAll(text, `\`, `\\`)
+	}
+	return "'" + text + "'"
+}
+
+// parquetType is the type inferred for a Parquet column from the generated records.
+type parquetType struct {
+	kind   string // int, float, bool, string, object, array or json
+	fields map[string]*parquetType
+	elem   *parquetType
+}
+
+func inferParquetType(v interface{}) *parquetType {
+	switch vv := v.(type) {
+	case nil:
+		return nil
+	case map[string]interface{}:
+		t := &parquetType{kind: "object", fields: make(map[string]*parquetType)}
+		for k, val := range vv {
+			t.fields[k] = inferParquetType(val)
+		}
+		return t
+	case []interface{}:
+		t := &parquetType{kind: "array"}
+		for _, item := range vv {
+			t.elem = mergeParquetTypes(t.elem, inferParquetType(item))
+		}
+		return t
+	}
+	return &parquetType{kind: scalarKind(v)}
+}
+
+func mergeParquetTypes(a, b *parquetType) *parquetType {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	case a.kind == "object" && b.kind == "object":
+		for k, t := range b.fields {
+			a.fields[k] = mergeParquetTypes(a.fields[k], t)
+		}
+		return a
+	case a.kind == "array" && b.kind == "array":
+		a.elem = mergeParquetTypes(a.elem, b.elem)
+		if a.elem != nil && a.elem.kind == "array" {
+			// Nested lists are stored as JSON text
+			a.elem = &parquetType{kind: "json"}
+		}
+		return a
+	case a.kind == "object" || a.kind == "array" || b.kind == "object" || b.kind == "array" || a.kind == "json" || b.kind == "json":
+		return &parquetType{kind: "json"}
+	}
+	return &parquetType{kind: mergeKinds(a.kind, b.kind)}
+}
+
+// node returns the Parquet node of a column holding values of type t.
+func (t *parquetType) node() parquet.Node {
+	if t == nil {
+		return parquet.String()
+	}
+	switch t.kind {
+	case "int":
+		return parquet.Int(64)
+	case "float":
+		return parquet.Leaf(parquet.DoubleType)
+	case "bool":
+		return parquet.Leaf(parquet.BooleanType)
+	case "json":
+		return parquet.JSON()
+	case "object":
+		group := parquet.Group{}
+		for k, f := range t.fields {
+			group[k] = f.fieldNode()
+		}
+		return group
+	}
+	return parquet.String()
+}
+
+// fieldNode returns the node of an object field: arrays become repeated
+// columns and everything else is optional.
+func (t *parquetType) fieldNode() parquet.Node {
+	if t != nil && t.kind == "array" {
+		return parquet.Repeated(t.elem.node())
+	}
+	return parquet.Optional(t.node())
+}
+
+// value converts a generated value to the Go type expected by the column.
+// Scalars of optional columns are returned as pointers, otherwise the
+// Parquet writer stores zero values such as false or 0 as null.
+func (t *parquetType) value(v interface{}, optional bool) interface{} {
+	if v == nil {
+		return nil
+	}
+	kind := "string"
+	if t != nil {
+		kind = t.kind
+	}
+	var scalar interface{}
+	switch kind {
+	case "int", "float":
+		n, ok := toFloat64(v)
+		if !ok {
+			return nil
+		}
+		if kind == "int" {
+			i := int64(n)
+			scalar = &i
+		} else {
+			scalar = &n
+		}
+	case "bool":
+		b, _ := v.(bool)
+		scalar = &b
+	case "json":
+		data, _ := json.Marshal(v)
+		text := string(data)
+		scalar = &text
+	case "object":
+		m, _ := v.(map[string]interface{})
+		out := make(map[string]interface{}, len(t.fields))
+		for k, f := range t.fields {
+			out[k] = f.value(m[k], f == nil || f.kind != "array")
+		}
+		return out
+	case "array":
+		items, _ := v.([]interface{})
+		out := make([]interface{}, 0, len(items))
+		for _, item := range items {
+			if item != nil {
+				out = append(out, t.elem.value(item, false))
+			}
+		}
+		return out
+	default:
+		text := scalarText(v)
+		scalar = &text
+	}
+	if optional {
+		return scalar
+	}
+	return reflect.ValueOf(scalar).Elem().Interface()
+}
+
+// toFloat64 converts a generated number to float64.
+func toFloat64(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func writeParquet(w io.Writer, records []interface{}) error {
+	var root *parquetType
+	for _, record := range records {
+		if _, ok := record.(map[string]interface{}); !ok {
+			record = map[string]interface{}{"value": record}
+		}
+		root = mergeParquetTypes(root, inferParquetType(record))
+	}
+	if root == nil || root.kind != "object" {
+		return fmt.Errorf("cannot infer a Parquet schema from the generated records")
+	}
+
+	schema := parquet.NewSchema("record", root.node())
+	writer := parquet.NewGenericWriter[map[string]any](w, schema)
+
+	rows := make([]map[string]any, 0, len(records))
+	for _, record := range records {
+		if _, ok := record.(map[string]interface{}); !ok {
+			record = map[string]interface{}{"value": record}
+		}
+		rows = append(rows, root.value(record, false).(map[string]interface{}))
+	}
+	if _, err := writer.Write(rows); err != nil {
+		return err
+	}
+	return writer.Close()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func sampleRecords() []interface{} {
+	return []interface{}{
+		map[string]interface{}{"id": 1.0, "name": "O'Brien", "active": true, "address": map[string]interface{}{"city": "Paris"}, "tags": []interface{}{"a", "b"}},
+		map[string]interface{}{"id": 2.0, "name": `back\slash`, "score": 1.5, "active": nil},
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	var out bytes.Buffer
+	if err := writeRecords(&out, sampleRecords(), OutputOptions{Format: "csv"}); err != nil {
+		t.Fatal(err)
+	}
+	want := "active,address.city,id,name,score,tags\n" +
+		"true,Paris,1,O'Brien,,\"[\"\"a\"\",\"\"b\"\"]\"\n" +
+		",,2,back\\slash,1.5,\n"
+	if out.String() != want {
+		t.Errorf("CSV:\n%s\nwant:\n%s", out.String(), want)
+	}
+}
+
+func TestWriteSQL(t *testing.T) {
+	tests := []struct {
+		dialect string
+		want    []string
+	}{
+		{"", []string{
+			`CREATE TABLE "people" (`, `"active" BOOLEAN`, `"id" BIGINT`, `"score" DOUBLE PRECISION`, `"name" TEXT`,
+			`INSERT INTO "people" ("active", "address.city", "id", "name", "score", "tags") VALUES`,
+			`(TRUE, 'Paris', 1, 'O''Brien', NULL, '["a","b"]'),`,
+			`(NULL, NULL, 2, 'back\slash', 1.5, NULL);`,
+		}},
+		{"mysql", []string{"CREATE TABLE `people` (", "`score` DOUBLE", `'back\\slash'`}},
+		{"SQLite", []string{`"active" INTEGER`, `"score" REAL`, `(1, 'Paris', 1,`}},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		if err := writeRecords(&out, sampleRecords(), OutputOptions{Format: "sql", Dialect: tt.dialect, Table: "people"}); err != nil {
+			t.Fatalf("%s: %v", tt.dialect, err)
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(out.String(), want) {
+				t.Errorf("%s SQL misses %s:\n%s", tt.dialect, want, out.String())
+			}
+		}
+	}
+}
+
+func TestWriteSQLBatches(t *testing.T) {
+	var records []interface{}
+	for i := 0; i < 5; i++ {
+		records = append(records, map[string]interface{}{"id": float64(i)})
+	}
+	var out bytes.Buffer
+	if err := writeRecords(&out, records, OutputOptions{Format: "sql", Table: "t", BatchSize: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if inserts := strings.Count(out.String(), "INSERT INTO"); inserts != 3 {
+		t.Errorf("%d INSERT statements for 5 rows in batches of 2, want 3", inserts)
+	}
+	if statements := strings.Count(out.String(), ";\n"); statements != 4 {
+		t.Errorf("%d statements, want 4:\n%s", statements, out.String())
+	}
+}
+
+func TestWriteYAML(t *testing.T) {
+	var out bytes.Buffer
+	records := []interface{}{map[string]interface{}{"id": 42.0, "price": 9.5, "nested": map[string]interface{}{"count": 3.0}}}
+	if err := writeRecords(&out, records, OutputOptions{Format: "yaml"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"id: 42\n", "price: 9.5\n", "count: 3\n"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("YAML misses %q:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestWriteGeneratedDataErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		file    string
+		records []interface{}
+		opts    OutputOptions
+	}{
+		{"bad.sql", sampleRecords(), OutputOptions{Dialect: "oracle"}},
+		{"empty.sql", []interface{}{map[string]interface{}{}}, OutputOptions{}},
+		{"none.sql", nil, OutputOptions{}},
+		{"data.out", sampleRecords(), OutputOptions{Format: "xml"}},
+	}
+	for _, tt := range tests {
+		file := filepath.Join(dir, tt.file)
+		if err := writeGeneratedData(file, tt.records, tt.opts); err == nil {
+			t.Errorf("%s: written without error", tt.file)
+		}
+		if _, err := os.Stat(file); !os.IsNotExist(err) {
+			t.Errorf("%s: the output file was left behind", tt.file)
+		}
+	}
+}
+
+func TestFormatFromFileName(t *testing.T) {
+	tests := map[string]string{
+		"out.json": "json", "out.JSONL": "ndjson", "out.ndjson": "ndjson", "out.csv": "csv",
+		"out.sql": "sql", "out.parquet": "parquet", "out.yml": "yaml", "out.yaml": "yaml", "out": "json",
+	}
+	for file, want := range tests {
+		if got := formatFromFileName(file); got != want {
+			t.Errorf("formatFromFileName(%q) = %q, want %q", file, got, want)
+		}
+	}
+}
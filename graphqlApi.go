@@ -0,0 +1,636 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/graphql-go/graphql"
+	"github.com/graphql-go/graphql/language/ast"
+)
+
+const graphqlPath = "/graphql"
+
+var (
+	graphqlLock      sync.Mutex
+	graphqlSchema    *graphql.Schema
+	graphqlWriteLock sync.Mutex // serializes mutations writing files
+)
+
+// graphqlRequest is the body of a GraphQL POST request.
+type graphqlRequest struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// invalidateGraphQLSchema makes the next GraphQL request rebuild the schema
+// from the served files.
+func invalidateGraphQLSchema() {
+	graphqlLock.Lock()
+	graphqlSchema = nil
+	graphqlLock.Unlock()
+}
+
+func currentGraphQLSchema() (*graphql.Schema, error) {
+	graphqlLock.Lock()
+	defer graphqlLock.Unlock()
+	if graphqlSchema != nil {
+		return graphqlSchema, nil
+	}
+	schema, err := buildGraphQLSchema()
+	if err != nil {
+		return nil, err
+	}
+	graphqlSchema = schema
+	return schema, nil
+}
+
+// handleGraphQL executes GraphQL queries, browsers get the GraphiQL page.
+func handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphqlRequest
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if req.Query == "" && strings.Contains(r.Header.Get("Accept"), "text/html") {
+			page, _ := staticFiles.ReadFile("static/graphiql.html")
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write(page)
+			return
+		}
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				writeJSONError(w, http.StatusBadRequest, "invalid variables: "+err.Error())
+				return
+			}
+		}
+	case http.MethodPost:
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql") {
+			body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, 1<<20))
+			if err != nil {
+				writeJSONError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			req.Query = string(body)
+		} else if err := readJSONBody(r, &req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		writeJSONError(w, http.StatusMethodNotAllowed, "GraphQL accepts GET and POST")
+		return
+	}
+	if req.Query == "" {
+		writeJSONError(w, http.StatusBadRequest, "query is required")
+		return
+	}
+
+	schema, err := currentGraphQLSchema()
+	if err != nil {
+		Lg.Errorf("Error building GraphQL schema: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "error building GraphQL schema: "+err.Error())
+		return
+	}
+	result := graphql.Do(graphql.Params{
+		Schema:         *schema,
+		RequestString:  req.Query,
+		VariableValues: req.Variables,
+		OperationName:  req.OperationName,
+		Context:        r.Context(),
+	})
+	writeJSON(w, http.StatusOK, result)
+}
+
+// jsonScalar is used for values without a consistent type and for mutation input.
+var jsonScalar = graphql.NewScalar(graphql.ScalarConfig{
+	Name:        "JSON",
+	Description: "Any JSON value",
+	Serialize:   func(value interface{}) interface{} { return value },
+	ParseValue:  func(value interface{}) interface{} { return value },
+	ParseLiteral: func(valueAST ast.Value) interface{} {
+		return parseJSONLiteral(valueAST)
+	},
+})
+
+func parseJSONLiteral(valueAST ast.Value) interface{} {
+	switch v := valueAST.(type) {
+	case *ast.StringValue:
+		return v.Value
+	case *ast.BooleanValue:
+		return v.Value
+	case *ast.IntValue:
+		n, _ := strconv.ParseFloat(v.Value, 64)
+		return n
+	case *ast.FloatValue:
+		n, _ := strconv.ParseFloat(v.Value, 64)
+		return n
+	case *ast.EnumValue:
+		return v.Value
+	case *ast.ListValue:
+		items := make([]interface{}, len(v.Values))
+		for i, item := range v.Values {
+			items[i] = parseJSONLiteral(item)
+		}
+		return items
+	case *ast.ObjectValue:
+		object := make(map[string]interface{}, len(v.Fields))
+		for _, field := range v.Fields {
+			object[field.Name.Value] = parseJSONLiteral(field.Value)
+		}
+		return object
+	}
+	return nil
+}
+
+var (
+	graphqlInvalidChars = regexp.MustCompile(`[^_a-zA-Z0-9]+`)
+	typeNameSeparators  = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+)
+
+// graphqlFieldName turns a JSON key or route into a valid GraphQL name.
+func graphqlFieldName(name string) string {
+	name = graphqlInvalidChars.ReplaceAllString(strings.Trim(name, "/"), "_")
+	if name == "" || unicode.IsDigit(rune(name[0])) {
+		name = "_" + name
+	}
+	return name
+}
+
+// graphqlTypeName turns a name into a PascalCase GraphQL type name.
+func graphqlTypeName(name string) string {
+	var b strings.Builder
+	for _, part := range typeNameSeparators.Split(name, -1) {
+		if part != "" {
+			b.WriteString(strings.ToUpper(part[:1]) + part[1:])
+		}
+	}
+	typeName := b.String()
+	if typeName == "" || unicode.IsDigit(rune(typeName[0])) {
+		typeName = "T" + typeName
+	}
+	return typeName
+}
+
+// singular makes a simple singular of a plural type name, Users -> User.
+func singular(name string) string {
+	if len(name) > 3 && strings.HasSuffix(name, "s") && !strings.HasSuffix(name, "ss") {
+		return name[:len(name)-1]
+	}
+	return name
+}
+
+// graphqlBuilder creates the GraphQL types of the served files.
+type graphqlBuilder struct {
+	typeNames map[string]bool
+}
+
+func (b *graphqlBuilder) uniqueTypeName(name string) string {
+	unique := name
+	for i := 2; b.typeNames[unique] || unique == "Query" || unique == "Mutation" || unique == "JSON"; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+	b.typeNames[unique] = true
+	return unique
+}
+
+// uniqueFieldName qualifies name with a number when fields already has it,
+// e.g. when a nested object type and a route give the same mutation.
+func uniqueFieldName(fields graphql.Fields, name string) string {
+	unique := name
+	for i := 2; fields[unique] != nil; i++ {
+		unique = name + strconv.Itoa(i)
+	}
+	return unique
+}
+
+func (b *graphqlBuilder) outputType(shape *jsonShape, typeName string) graphql.Output {
+	switch shape.Kind {
+	case "object":
+		if len(shape.Fields) == 0 {
+			return jsonScalar
+		}
+		fields := graphql.Fields{}
+		for _, key := range shape.Order {
+			name := graphqlFieldName(key)
+			if _, exists := fields[name]; exists {
+				continue
+			}
+			key := key
+			fields[name] = &graphql.Field{
+				Type: b.outputType(shape.Fields[key], typeName+graphqlTypeName(key)),
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					if record, ok := p.Source.(map[string]interface{}); ok {
+						return record[key], nil
+					}
+					return nil, nil
+				},
+			}
+		}
+		return graphql.NewObject(graphql.ObjectConfig{Name: b.uniqueTypeName(typeName), Fields: fields})
+	case "list":
+		return graphql.NewList(b.outputType(shape.Elem, singular(typeName)))
+	case "scalar":
+		switch shape.Scalar {
+		case "Int":
+			return graphql.Int
+		case "Int64", "Float":
+			return graphql.Float
+		case "String":
+			return graphql.String
+		case "Boolean":
+			return graphql.Boolean
+		}
+	}
+	return jsonScalar
+}
+
+// scalarType returns the GraphQL type of a scalar shape usable as a filter argument.
+func scalarType(shape *jsonShape) (graphql.Input, bool) {
+	if shape.Kind != "scalar" {
+		return nil, false
+	}
+	switch shape.Scalar {
+	case "Int":
+		return graphql.Int, true
+	case "Int64", "Float":
+		return graphql.Float, true
+	case "String":
+		return graphql.String, true
+	case "Boolean":
+		return graphql.Boolean, true
+	}
+	return nil, false
+}
+
+// buildGraphQLSchema infers a schema from the JSON files: every file is a root
+// query field, arrays are lists with filter, sort and pagination arguments and
+// nested objects become types. Array files get create, update and delete mutations.
+func buildGraphQLSchema() (*graphql.Schema, error) {
+	routesLock.RLock()
+	files := make(map[string]string, len(routeFiles))
+	for route, file := range routeFiles {
+		if !isSampleFile(file) && !isWebSocketMockFile(file) && !isPatternRoute(route) {
+			files[route] = file
+		}
+	}
+	routesLock.RUnlock()
+
+	routeNames := make([]string, 0, len(files))
+	for route := range files {
+		routeNames = append(routeNames, route)
+	}
+	sort.Strings(routeNames)
+
+	b := &graphqlBuilder{typeNames: make(map[string]bool)}
+	query := graphql.Fields{
+		"_routes": &graphql.Field{
+			Type:        graphql.NewList(graphql.String),
+			Description: "Routes available as query fields",
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return routeNames, nil
+			},
+		},
+	}
+	mutation := graphql.Fields{}
+
+	for _, route := range routeNames {
+		file := files[route]
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			continue
+		}
+		var content interface{}
+		if err := json.Unmarshal(data, &content); err != nil {
+			Lg.Warnf("GraphQL schema skips %s: %v", file, err)
+			continue
+		}
+		fieldName := graphqlFieldName(route)
+		if _, exists := query[fieldName]; exists {
+			continue
+		}
+		shape := inferShape(content)
+		typeName := graphqlTypeName(fieldName)
+
+		if shape.Kind != "list" {
+			outType := b.outputType(shape, typeName)
+			query[fieldName] = &graphql.Field{
+				Type:        outType,
+				Description: "Content of " + file,
+				Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+					return readGraphQLFile(file)
+				},
+			}
+			if object, ok := outType.(*graphql.Object); ok {
+				mutation[uniqueFieldName(mutation, "update"+object.Name())] = &graphql.Field{
+					Type:        outType,
+					Description: "Merges input into the object of " + file,
+					Args:        graphql.FieldConfigArgument{"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(jsonScalar)}},
+					Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+						return updateGraphQLObject(file, p.Args["input"])
+					},
+				}
+			}
+			continue
+		}
+
+		listType := b.outputType(shape, typeName).(*graphql.List)
+		args := graphql.FieldConfigArgument{
+			"limit":  &graphql.ArgumentConfig{Type: graphql.Int, Description: "Maximum number of records"},
+			"offset": &graphql.ArgumentConfig{Type: graphql.Int, Description: "Number of records to skip"},
+			"sortBy": &graphql.ArgumentConfig{Type: graphql.String, Description: "Field to sort by"},
+			"desc":   &graphql.ArgumentConfig{Type: graphql.Boolean, Description: "Sort in descending order"},
+		}
+		filters := make(map[string]string) // argument -> JSON key
+		if shape.Elem.Kind == "object" {
+			for _, key := range shape.Elem.Order {
+				argType, ok := scalarType(shape.Elem.Fields[key])
+				argName := graphqlFieldName(key)
+				if _, reserved := args[argName]; !ok || reserved {
+					continue
+				}
+				args[argName] = &graphql.ArgumentConfig{Type: argType, Description: "Only records whose " + key + " equals this value"}
+				filters[argName] = key
+			}
+		}
+		query[fieldName] = &graphql.Field{
+			Type:        listType,
+			Description: "Records of " + file,
+			Args:        args,
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				content, err := readGraphQLFile(file)
+				if err != nil {
+					return nil, err
+				}
+				records, _ := content.([]interface{})
+				return queryRecords(records, filters, p.Args), nil
+			},
+		}
+
+		object, ok := listType.OfType.(*graphql.Object)
+		if !ok {
+			continue
+		}
+		_, hasID := shape.Elem.Fields["id"]
+		mutation[uniqueFieldName(mutation, "create"+object.Name())] = &graphql.Field{
+			Type:        object,
+			Description: "Appends a record to " + file,
+			Args:        graphql.FieldConfigArgument{"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(jsonScalar)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return createGraphQLRecord(file, p.Args["input"], hasID)
+			},
+		}
+		if !hasID {
+			continue
+		}
+		mutation[uniqueFieldName(mutation, "update"+object.Name())] = &graphql.Field{
+			Type:        object,
+			Description: "Merges input into the record of " + file + " with the given id",
+			Args: graphql.FieldConfigArgument{
+				"id":    &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)},
+				"input": &graphql.ArgumentConfig{Type: graphql.NewNonNull(jsonScalar)},
+			},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return updateGraphQLRecord(file, p.Args["id"].(string), p.Args["input"])
+			},
+		}
+		mutation[uniqueFieldName(mutation, "delete"+object.Name())] = &graphql.Field{
+			Type:        graphql.Boolean,
+			Description: "Removes the record of " + file + " with the given id",
+			Args:        graphql.FieldConfigArgument{"id": &graphql.ArgumentConfig{Type: graphql.NewNonNull(graphql.ID)}},
+			Resolve: func(p graphql.ResolveParams) (interface{}, error) {
+				return deleteGraphQLRecord(file, p.Args["id"].(string))
+			},
+		}
+	}
+
+	config := graphql.SchemaConfig{Query: graphql.NewObject(graphql.ObjectConfig{Name: "Query", Fields: query})}
+	if len(mutation) > 0 {
+		config.Mutation = graphql.NewObject(graphql.ObjectConfig{Name: "Mutation", Fields: mutation})
+	}
+	schema, err := graphql.NewSchema(config)
+	if err != nil {
+		return nil, err
+	}
+	log.Printf("GraphQL schema built from %d files", len(routeNames))
+	Lg.Infof("GraphQL schema built from %d files", len(routeNames))
+	return &schema, nil
+}
+
+func readGraphQLFile(file string) (interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var content interface{}
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, fmt.Errorf("invalid JSON in %s: %v", file, err)
+	}
+	return content, nil
+}
+
+// queryRecords filters, sorts and paginates records by the arguments of a list field.
+func queryRecords(records []interface{}, filters map[string]string, args map[string]interface{}) []interface{} {
+	result := make([]interface{}, 0, len(records))
+	for _, record := range records {
+		object, _ := record.(map[string]interface{})
+		matches := true
+		for argName, key := range filters {
+			want, ok := args[argName]
+			if ok && !jsonValuesEqual(object[key], want) {
+				matches = false
+				break
+			}
+		}
+		if matches {
+			result = append(result, record)
+		}
+	}
+
+	if sortBy, ok := args["sortBy"].(string); ok && sortBy != "" {
+		desc, _ := args["desc"].(bool)
+		sort.SliceStable(result, func(i, j int) bool {
+			a, _ := result[i].(map[string]interface{})
+			b, _ := result[j].(map[string]interface{})
+			if desc {
+				return jsonValueLess(b[sortBy], a[sortBy])
+			}
+			return jsonValueLess(a[sortBy], b[sortBy])
+		})
+	}
+
+	if offset, ok := args["offset"].(int); ok && offset > 0 {
+		if offset > len(result) {
+			offset = len(result)
+		}
+		result = result[offset:]
+	}
+	if limit, ok := args["limit"].(int); ok && limit >= 0 && limit < len(result) {
+		result = result[:limit]
+	}
+	return result
+}
+
+// jsonValuesEqual compares a decoded JSON value with a GraphQL argument.
+func jsonValuesEqual(value, arg interface{}) bool {
+	if a, ok := toFloat(value); ok {
+		if b, ok := toFloat(arg); ok {
+			return a == b
+		}
+	}
+	return fmt.Sprint(value) == fmt.Sprint(arg)
+}
+
+func jsonValueLess(a, b interface{}) bool {
+	if x, ok := toFloat(a); ok {
+		if y, ok := toFloat(b); ok {
+			return x < y
+		}
+	}
+	return fmt.Sprint(a) < fmt.Sprint(b)
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// writeGraphQLFile saves content after a mutation and rebuilds the schema on the next query.
+func writeGraphQLFile(file string, content interface{}) error {
+	data, err := json.MarshalIndent(content, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(file, data, 0644); err != nil {
+		return err
+	}
+	invalidateGraphQLSchema()
+	log.Printf("File %s was changed by a GraphQL mutation", file)
+	Lg.Infof("File %s was changed by a GraphQL mutation", file)
+	return nil
+}
+
+func readGraphQLRecords(file string) ([]interface{}, error) {
+	content, err := readGraphQLFile(file)
+	if err != nil {
+		return nil, err
+	}
+	records, ok := content.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s does not contain an array", file)
+	}
+	return records, nil
+}
+
+func createGraphQLRecord(file string, input interface{}, hasID bool) (interface{}, error) {
+	record, ok := input.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("input must be an object")
+	}
+	graphqlWriteLock.Lock()
+	defer graphqlWriteLock.Unlock()
+	records, err := readGraphQLRecords(file)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := record["id"]; hasID && !ok {
+		// Continue numeric ids
+		maxID := 0.0
+		for _, existing := range records {
+			if object, ok := existing.(map[string]interface{}); ok {
+				if id, ok := object["id"].(float64); ok && id > maxID {
+					maxID = id
+				}
+			}
+		}
+		record["id"] = maxID + 1
+	}
+	if err := writeGraphQLFile(file, append(records, record)); err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func updateGraphQLRecord(file, id string, input interface{}) (interface{}, error) {
+	patch, ok := input.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("input must be an object")
+	}
+	graphqlWriteLock.Lock()
+	defer graphqlWriteLock.Unlock()
+	records, err := readGraphQLRecords(file)
+	if err != nil {
+		return nil, err
+	}
+	for _, existing := range records {
+		object, ok := existing.(map[string]interface{})
+		if !ok || !jsonValuesEqual(object["id"], id) {
+			continue
+		}
+		for k, v := range patch {
+			object[k] = v
+		}
+		if err := writeGraphQLFile(file, records); err != nil {
+			return nil, err
+		}
+		return object, nil
+	}
+	return nil, fmt.Errorf("no record with id %s in %s", id, file)
+}
+
+func deleteGraphQLRecord(file, id string) (interface{}, error) {
+	graphqlWriteLock.Lock()
+	defer graphqlWriteLock.Unlock()
+	records, err := readGraphQLRecords(file)
+	if err != nil {
+		return nil, err
+	}
+	for i, existing := range records {
+		if object, ok := existing.(map[string]interface{}); ok && jsonValuesEqual(object["id"], id) {
+			if err := writeGraphQLFile(file, append(records[:i], records[i+1:]...)); err != nil {
+				return nil, err
+			}
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func updateGraphQLObject(file string, input interface{}) (interface{}, error) {
+	patch, ok := input.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("input must be an object")
+	}
+	graphqlWriteLock.Lock()
+	defer graphqlWriteLock.Unlock()
+	content, err := readGraphQLFile(file)
+	if err != nil {
+		return nil, err
+	}
+	object, ok := content.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s does not contain an object", file)
+	}
+	for k, v := range patch {
+		object[k] = v
+	}
+	if err := writeGraphQLFile(file, object); err != nil {
+		return nil, err
+	}
+	return object, nil
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// importedEntry is one request with its response, read from a HAR file or a
+// saved example of a Postman collection.
+type importedEntry struct {
+	Source   string // where the entry was found, for the report
+	Request  *recordedRequest
+	Response *recordedResponse
+}
+
+// runImport implements `goeasyjson import har|postman [options] file`. It
+// writes the entries as route files and rules like -record, and returns the
+// exit code.
+func runImport(args []string) int {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	dir := fs.String("dir", ".", "Folder served by GoEasyJson to write the routes to")
+	query := fs.String("query", "*", "Query parameters telling responses apart, * for all of them")
+	headers := fs.String("headers", "", "Request headers telling responses apart (e.g. -headers Accept-Language)")
+	overwrite := fs.Bool("overwrite", false, "Replace route files and recorded rules that already exist")
+	fs.StringVar(&redactHeaders, "redact", redactHeaders, "Headers and query parameters whose values are redacted")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: goeasyjson import har|postman [options] file")
+		fs.PrintDefaults()
+	}
+	if len(args) == 0 {
+		fs.Usage()
+		return 2
+	}
+	format := args[0]
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 || (format != "har" && format != "postman") {
+		fs.Usage()
+		return 2
+	}
+
+	data, err := ioutil.ReadFile(fs.Arg(0))
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	var entries []importedEntry
+	if format == "har" {
+		entries, err = parseHAR(data)
+	} else {
+		entries, err = parsePostman(data)
+	}
+	if err != nil {
+		fmt.Printf("Cannot import %s: %v\n", fs.Arg(0), err)
+		return 1
+	}
+	if err := os.Chdir(*dir); err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	keys := recordingKeys{Headers: splitList(*headers), PathParams: format == "postman"}
+	if *query == "*" {
+		keys.AllQuery = true
+	} else {
+		keys.Query = splitList(*query)
+	}
+	report := importEntries(entries, keys, *overwrite)
+	fmt.Println(LightGreen.Render(fmt.Sprintf("Imported %d responses into %d routes of %s, %d duplicates skipped.",
+		report.imported, len(report.routes), *dir, report.duplicates)))
+	for _, skipped := range report.skipped {
+		fmt.Println(LightYellow.Render("Skipped " + skipped))
+	}
+	for _, conflict := range report.conflicts {
+		fmt.Println(Red.Render("Conflict: " + conflict))
+	}
+	return 0
+}
+
+type importReport struct {
+	imported   int
+	duplicates int
+	routes     map[string]bool
+	skipped    []string
+	conflicts  []string
+}
+
+// importEntries saves the entries. An entry with the same method, path and
+// keys as an earlier one is a duplicate when the responses are identical and
+// a conflict otherwise, the first response is kept. Entries replacing a route
+// file or recorded rule that existed before the import are conflicts too,
+// unless overwrite is set.
+func importEntries(entries []importedEntry, keys recordingKeys, overwrite bool) importReport {
+	report := importReport{routes: make(map[string]bool)}
+	type saved struct {
+		source string
+		digest [32]byte
+	}
+	seen := make(map[string]saved)
+	existing := make(map[string]existingRoute)
+	for _, entry := range entries {
+		rec, err := newRecording(entry.Request, entry.Response, keys)
+		if err != nil {
+			report.skipped = append(report.skipped, fmt.Sprintf("%s %s (%s): %v", entry.Request.Method, entry.Request.Path, entry.Source, err))
+			continue
+		}
+		key := rec.Base + "\x00" + rec.Rule.Name
+		digest := sha256.Sum256(append([]byte(fmt.Sprintf("%d\n", rec.Rule.Status)), rec.Body...))
+		if previous, ok := seen[key]; ok {
+			if previous.digest == digest {
+				report.duplicates++
+			} else {
+				report.conflicts = append(report.conflicts, fmt.Sprintf("%s %s: %s answers differently than %s, kept the first",
+					entry.Request.Method, entry.Request.Path, entry.Source, previous.source))
+			}
+			continue
+		}
+		route, ok := existing[rec.Base]
+		if !ok {
+			// Read before this import writes to the route
+			route = readExistingRoute(rec.Base)
+			existing[rec.Base] = route
+		}
+		if !overwrite && (route.file && rec.plainGet() || route.rules[rec.Rule.Name]) {
+			report.conflicts = append(report.conflicts, fmt.Sprintf("%s %s (%s): %s already answers it, kept the file (use -overwrite to replace it)",
+				entry.Request.Method, entry.Request.Path, entry.Source, rec.Base+".json"))
+			continue
+		}
+		if err := rec.save(); err != nil {
+			report.skipped = append(report.skipped, fmt.Sprintf("%s %s (%s): %v", entry.Request.Method, entry.Request.Path, entry.Source, err))
+			continue
+		}
+		seen[key] = saved{source: entry.Source, digest: digest}
+		report.imported++
+		report.routes[rec.Base] = true
+	}
+	return report
+}
+
+// existingRoute is what a route held before the import: its route file and
+// the names of its rules.
+type existingRoute struct {
+	file  bool
+	rules map[string]bool
+}
+
+func readExistingRoute(base string) existingRoute {
+	var route existingRoute
+	_, err := os.Stat(base + ".json")
+	route.file = err == nil
+	rules := &mockRules{}
+	if data, err := ioutil.ReadFile(base + rulesSuffix); err == nil && json.Unmarshal(data, rules) == nil {
+		route.rules = make(map[string]bool)
+		for _, rule := range rules.Rules {
+			route.rules[rule.Name] = true
+		}
+	}
+	return route
+}
+
+// harFile is the part of the HTTP Archive format read by the import.
+type harFile struct {
+	Log struct {
+		Entries []struct {
+			Request struct {
+				Method  string `json:"method"`
+				URL     string `json:"url"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+			} `json:"request"`
+			Response struct {
+				Status  int `json:"status"`
+				Headers []struct {
+					Name  string `json:"name"`
+					Value string `json:"value"`
+				} `json:"headers"`
+				Content struct {
+					MimeType string `json:"mimeType"`
+					Text     string `json:"text"`
+					Encoding string `json:"encoding"`
+				} `json:"content"`
+			} `json:"response"`
+		} `json:"entries"`
+	} `json:"log"`
+}
+
+func parseHAR(data []byte) ([]importedEntry, error) {
+	var har harFile
+	if err := json.Unmarshal(data, &har); err != nil {
+		return nil, fmt.Errorf("invalid HAR: %v", err)
+	}
+	entries := make([]importedEntry, 0, len(har.Log.Entries))
+	for i, e := range har.Log.Entries {
+		u, err := url.Parse(e.Request.URL)
+		if err != nil {
+			continue
+		}
+		req := &recordedRequest{Method: strings.ToUpper(e.Request.Method), Path: u.Path, Query: u.Query(), Header: http.Header{}}
+		for _, h := range e.Request.Headers {
+			if !strings.HasPrefix(h.Name, ":") {
+				req.Header.Add(h.Name, h.Value)
+			}
+		}
+		resp := &recordedResponse{Status: e.Response.Status, Header: http.Header{}, Body: []byte(e.Response.Content.Text)}
+		for _, h := range e.Response.Headers {
+			if !strings.HasPrefix(h.Name, ":") {
+				resp.Header.Add(h.Name, h.Value)
+			}
+		}
+		if e.Response.Content.Encoding == "base64" {
+			if resp.Body, err = base64.StdEncoding.DecodeString(e.Response.Content.Text); err != nil {
+				continue
+			}
+		}
+		if resp.Header.Get("Content-Type") == "" && e.Response.Content.MimeType != "" {
+			resp.Header.Set("Content-Type", e.Response.Content.MimeType)
+		}
+		entries = append(entries, importedEntry{Source: fmt.Sprintf("entry %d", i+1), Request: req, Response: resp})
+	}
+	return entries, nil
+}
+
+// postmanItem is a request or a folder of a Postman collection (v2.0 or v2.1).
+type postmanItem struct {
+	Name     string            `json:"name"`
+	Item     []postmanItem     `json:"item"`
+	Request  *postmanRequest   `json:"request"`
+	Response []postmanResponse `json:"response"`
+}
+
+type postmanRequest struct {
+	Method string          `json:"method"`
+	URL    json.RawMessage `json:"url"` // a string or {"raw", "path", "query"}
+	Header []postmanHeader `json:"header"`
+}
+
+type postmanResponse struct {
+	Name            string          `json:"name"`
+	OriginalRequest *postmanRequest `json:"originalRequest"`
+	Code            int             `json:"code"`
+	Header          []postmanHeader `json:"header"`
+	Body            string          `json:"body"`
+}
+
+type postmanHeader struct {
+	Key      string `json:"key"`
+	Value    string `json:"value"`
+	Disabled bool   `json:"disabled"`
+}
+
+// Postman variables such as {{baseUrl}} or :id in a path.
+var (
+	postmanVariable = regexp.MustCompile(`^\{\{\s*([A-Za-z0-9_.-]+)\s*\}\}$`)
+	postmanHost     = regexp.MustCompile(`^(https?://|\{\{[^}]*\}\})[^/?]*`) // paths without either have no host
+)
+
+func parsePostman(data []byte) ([]importedEntry, error) {
+	var collection postmanItem
+	if err := json.Unmarshal(data, &collection); err != nil {
+		return nil, fmt.Errorf("invalid Postman collection: %v", err)
+	}
+	if len(collection.Item) == 0 {
+		return nil, fmt.Errorf("the collection has no requests")
+	}
+	var entries []importedEntry
+	var walk func(items []postmanItem, folder string)
+	walk = func(items []postmanItem, folder string) {
+		for _, item := range items {
+			name := strings.TrimPrefix(folder+" / "+item.Name, " / ")
+			if len(item.Item) > 0 {
+				walk(item.Item, name)
+				continue
+			}
+			for _, example := range item.Response {
+				request := example.OriginalRequest
+				if request == nil {
+					request = item.Request
+				}
+				if request == nil {
+					continue
+				}
+				req, err := postmanRecordedRequest(request)
+				if err != nil {
+					continue
+				}
+				resp := &recordedResponse{Status: example.Code, Header: http.Header{}, Body: []byte(example.Body)}
+				if resp.Status == 0 {
+					resp.Status = http.StatusOK
+				}
+				for _, h := range example.Header {
+					if !h.Disabled {
+						resp.Header.Add(h.Key, h.Value)
+					}
+				}
+				entries = append(entries, importedEntry{Source: fmt.Sprintf("%q example %q", name, example.Name), Request: req, Response: resp})
+			}
+		}
+	}
+	walk(collection.Item, "")
+	return entries, nil
+}
+
+// postmanRecordedRequest reads the method, path and query of a Postman
+// request. Path variables (:id or {{id}}) become [id] path parameters.
+func postmanRecordedRequest(request *postmanRequest) (*recordedRequest, error) {
+	var raw string
+	var urlObject struct {
+		Raw   string   `json:"raw"`
+		Path  []string `json:"path"`
+		Query []struct {
+			Key      string `json:"key"`
+			Value    string `json:"value"`
+			Disabled bool   `json:"disabled"`
+		} `json:"query"`
+	}
+	if err := json.Unmarshal(request.URL, &raw); err != nil {
+		if err := json.Unmarshal(request.URL, &urlObject); err != nil {
+			return nil, err
+		}
+		raw = urlObject.Raw
+	}
+
+	query := url.Values{}
+	segments := urlObject.Path
+	if segments == nil {
+		// Only the raw URL, e.g. {{baseUrl}}/users/:id?role=admin
+		rest := postmanHost.ReplaceAllString(raw, "")
+		if i := strings.Index(rest, "?"); i >= 0 {
+			query, _ = url.ParseQuery(rest[i+1:])
+			rest = rest[:i]
+		}
+		segments = strings.Split(strings.Trim(rest, "/"), "/")
+	} else {
+		for _, q := range urlObject.Query {
+			if !q.Disabled {
+				query.Add(q.Key, q.Value)
+			}
+		}
+	}
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") && len(segment) > 1 {
+			segments[i] = "[" + segment[1:] + "]"
+		} else if m := postmanVariable.FindStringSubmatch(segment); m != nil {
+			segments[i] = "[" + m[1] + "]"
+		}
+	}
+
+	req := &recordedRequest{Method: strings.ToUpper(request.Method), Path: "/" + strings.Join(segments, "/"), Query: query, Header: http.Header{}}
+	if req.Method == "" {
+		req.Method = http.MethodGet
+	}
+	for _, h := range request.Header {
+		if !h.Disabled {
+			req.Header.Add(h.Key, h.Value)
+		}
+	}
+	return req, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPostmanRecordedRequest(t *testing.T) {
+	tests := []struct {
+		url, path, query string
+	}{
+		{`"{{baseUrl}}/users/:id?role=admin"`, "/users/[id]", "role=admin"},
+		{`"https://api.example.com/v1/orders"`, "/v1/orders", ""},
+		{`"http://localhost:3000/users/{{userId}}"`, "/users/[userId]", ""},
+		{`"users/1"`, "/users/1", ""},
+		{`"/users/1?page=2"`, "/users/1", "page=2"},
+		{`{"raw": "{{host}}/ignored", "path": ["orders", ":orderId"], "query": [{"key": "a", "value": "1"}, {"key": "b", "value": "2", "disabled": true}]}`, "/orders/[orderId]", "a=1"},
+	}
+	for _, tt := range tests {
+		req, err := postmanRecordedRequest(&postmanRequest{Method: "get", URL: json.RawMessage(tt.url)})
+		if err != nil {
+			t.Errorf("%s: %v", tt.url, err)
+			continue
+		}
+		if req.Method != http.MethodGet || req.Path != tt.path || url.Values(req.Query).Encode() != tt.query {
+			t.Errorf("%s: %s %s?%s, want GET %s?%s", tt.url, req.Method, req.Path, url.Values(req.Query).Encode(), tt.path, tt.query)
+		}
+	}
+}
+
+func TestImportEntries(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile("orders.json", []byte(`[{"id": 1}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	entry := func(source, target, body string) importedEntry {
+		u, _ := url.Parse(target)
+		return importedEntry{
+			Source:   source,
+			Request:  &recordedRequest{Method: http.MethodGet, Path: u.Path, Query: u.Query(), Header: http.Header{}},
+			Response: &recordedResponse{Status: http.StatusOK, Header: http.Header{}, Body: []byte(body)},
+		}
+	}
+	keys := recordingKeys{AllQuery: true}
+
+	report := importEntries([]importedEntry{
+		entry("first", "/users", `[{"id": 1}]`),
+		entry("again", "/users", `[{"id": 1}]`),
+		entry("other", "/users", `[{"id": 2}]`),
+		entry("page", "/users?page=2", `[{"id": 3}]`),
+		entry("existing", "/orders", `[{"id": 9}]`),
+		entry("new rule", "/orders?status=open", `[]`),
+	}, keys, false)
+	if report.imported != 3 || report.duplicates != 1 || len(report.conflicts) != 2 {
+		t.Fatalf("imported %d, duplicates %d, conflicts %q", report.imported, report.duplicates, report.conflicts)
+	}
+	if !strings.Contains(report.conflicts[0], "kept the first") || !strings.Contains(report.conflicts[1], "-overwrite") {
+		t.Errorf("conflicts %q", report.conflicts)
+	}
+	if data, _ := os.ReadFile("orders.json"); string(data) != `[{"id": 1}]` {
+		t.Errorf("orders.json was replaced: %s", data)
+	}
+
+	// A second import meets the routes and rules of the first one
+	changed := []importedEntry{entry("later", "/users", `[{"id": 4}]`), entry("later page", "/users?page=2", `[{"id": 5}]`)}
+	if report := importEntries(changed, keys, false); report.imported != 0 || len(report.conflicts) != 2 {
+		t.Errorf("without -overwrite: imported %d, conflicts %q", report.imported, report.conflicts)
+	}
+	if report := importEntries(changed, keys, true); report.imported != 2 || len(report.conflicts) != 0 {
+		t.Errorf("with -overwrite: imported %d, conflicts %q", report.imported, report.conflicts)
+	}
+	if data, _ := os.ReadFile("users.json"); !strings.Contains(string(data), "4") {
+		t.Errorf("users.json was not replaced: %s", data)
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -57,3 +58,100 @@ func analyzeValueFormat(value interface{}) JSONFormatInfo {
 
 	return info
 }
+
+// jsonShape is the structure inferred from JSON values, merged over all
+// elements of arrays so that optional fields are found too.
+type jsonShape struct {
+	Kind     string // object, list, scalar or null
+	Scalar   string // Int, Int64, Float, String, Boolean or JSON
+	Decimals int    // most decimal places seen in a Float
+	Fields   map[string]*jsonShape
+	Order    []string
+	Elem     *jsonShape
+}
+
+// inferShape analyzes the structure of a decoded JSON value.
+func inferShape(v interface{}) *jsonShape {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		shape := &jsonShape{Kind: "object", Fields: make(map[string]*jsonShape)}
+		keys := make([]string, 0, len(vv))
+		for k := range vv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			shape.Fields[k] = inferShape(vv[k])
+			shape.Order = append(shape.Order, k)
+		}
+		return shape
+	case []interface{}:
+		shape := &jsonShape{Kind: "list", Elem: &jsonShape{Kind: "null"}}
+		for _, item := range vv {
+			shape.Elem = mergeShapes(shape.Elem, inferShape(item))
+		}
+		return shape
+	case bool:
+		return &jsonShape{Kind: "scalar", Scalar: "Boolean"}
+	case float64:
+		info := analyzeValueFormat(vv)
+		switch {
+		case info.IsInt && vv >= math.MinInt32 && vv <= math.MaxInt32:
+			return &jsonShape{Kind: "scalar", Scalar: "Int"}
+		case info.IsInt:
+			return &jsonShape{Kind: "scalar", Scalar: "Int64"}
+		}
+		return &jsonShape{Kind: "scalar", Scalar: "Float", Decimals: info.FloatDecimals}
+	case string:
+		return &jsonShape{Kind: "scalar", Scalar: "String"}
+	}
+	return &jsonShape{Kind: "null"}
+}
+
+var numberRank = map[string]int{"Int": 1, "Int64": 2, "Float": 3}
+
+// mergeShapes combines the shapes of two values found at the same place.
+func mergeShapes(a, b *jsonShape) *jsonShape {
+	switch {
+	case a.Kind == "null":
+		return b
+	case b.Kind == "null":
+		return a
+	case a.Kind != b.Kind:
+		return &jsonShape{Kind: "scalar", Scalar: "JSON"}
+	}
+	switch a.Kind {
+	case "object":
+		merged := &jsonShape{Kind: "object", Fields: make(map[string]*jsonShape)}
+		for _, k := range a.Order {
+			merged.Fields[k] = a.Fields[k]
+			merged.Order = append(merged.Order, k)
+		}
+		for _, k := range b.Order {
+			if existing, ok := merged.Fields[k]; ok {
+				merged.Fields[k] = mergeShapes(existing, b.Fields[k])
+			} else {
+				merged.Fields[k] = b.Fields[k]
+				merged.Order = append(merged.Order, k)
+			}
+		}
+		return merged
+	case "list":
+		return &jsonShape{Kind: "list", Elem: mergeShapes(a.Elem, b.Elem)}
+	}
+	if a.Scalar == b.Scalar && a.Decimals >= b.Decimals {
+		return a
+	}
+	if numberRank[a.Scalar] > 0 && numberRank[b.Scalar] > 0 {
+		// Int < Int64 < Float, keep the wider type
+		merged := *a
+		if numberRank[b.Scalar] > numberRank[a.Scalar] {
+			merged.Scalar = b.Scalar
+		}
+		if b.Decimals > merged.Decimals {
+			merged.Decimals = b.Decimals
+		}
+		return &merged
+	}
+	return &jsonShape{Kind: "scalar", Scalar: "JSON"}
+}
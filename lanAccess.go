@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// Networks of the -allow and -deny flags.
+var allowedNets, deniedNets []*net.IPNet
+
+// listenAddress is the address the server listens on for port.
+func listenAddress(p int) string {
+	return net.JoinHostPort(bindHost, strconv.Itoa(p))
+}
+
+// displayHost is the host shown in URLs: localhost for loopback and
+// all-interfaces binds, else the -host address.
+func displayHost() string {
+	ip := net.ParseIP(bindHost)
+	switch {
+	case bindHost == "" || bindHost == "localhost" || (ip != nil && (ip.IsLoopback() || ip.IsUnspecified())):
+		return "localhost"
+	case ip != nil && ip.To4() == nil:
+		return "[" + bindHost + "]"
+	}
+	return bindHost
+}
+
+// loopbackBind reports whether only this machine can reach the server.
+func loopbackBind() bool {
+	ip := net.ParseIP(bindHost)
+	return bindHost == "localhost" || (ip != nil && ip.IsLoopback())
+}
+
+// adminPath reports whether p belongs to the admin API or the Web UI events,
+// which edit and expose the mocks.
+func adminPath(p string) bool {
+	return p == "/ws" || strings.HasPrefix(p, adminPrefix+"/")
+}
+
+// reachableURLs lists the base URLs of the server, one per LAN address when
+// it listens on every interface, so devices on the network can use them.
+func reachableURLs() []string {
+	urls := []string{serverURL()}
+	ip := net.ParseIP(bindHost)
+	if bindHost != "" && (ip == nil || !ip.IsUnspecified()) {
+		return urls
+	}
+	_, ips := localHostNames()
+	for _, lan := range ips {
+		if lan.IsLoopback() || (ip != nil && ip.To4() != nil && lan.To4() == nil) {
+			continue // 0.0.0.0 only listens on IPv4
+		}
+		urls = append(urls, serverScheme()+"://"+net.JoinHostPort(lan.String(), strconv.Itoa(port)))
+	}
+	return urls
+}
+
+// parseIPList reads a comma separated list of CIDR networks and addresses.
+func parseIPList(list string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	for _, item := range splitList(list) {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid address %q, expected an IP or CIDR such as 192.168.1.0/24", item)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			item += "/" + strconv.Itoa(bits)
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q, expected an IP or CIDR such as 192.168.1.0/24", item)
+		}
+		nets = append(nets, network)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, network := range nets {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientHost is the address of the client of r, without its port.
+func clientHost(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// isLocalClient reports whether r comes from this machine.
+func isLocalClient(r *http.Request) bool {
+	ip := net.ParseIP(clientHost(r))
+	return ip != nil && ip.IsLoopback()
+}
+
+// clientAllowed reports whether the client at ip may use the server: denied
+// networks never, this machine always, others when -allow is empty or
+// lists them.
+func clientAllowed(ip net.IP) bool {
+	if containsIP(deniedNets, ip) {
+		return false
+	}
+	if ip.IsLoopback() || len(allowedNets) == 0 {
+		return true
+	}
+	return containsIP(allowedNets, ip)
+}
+
+// restrictClients answers 403 to clients outside the -allow networks or in
+// the -deny networks, and to other machines calling the admin API without
+// -lan-admin.
+func restrictClients(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := clientHost(r)
+		ip := net.ParseIP(host)
+		if ip == nil || !clientAllowed(ip) {
+			log.Printf("Refused %s %s from %s", r.Method, r.URL.Path, host)
+			Lg.Warnf("Refused %s %s from %s", r.Method, r.URL.Path, host)
+			writeJSONError(w, http.StatusForbidden, "access from "+host+" is not allowed")
+			return
+		}
+		if adminPath(r.URL.Path) && !lanAdmin && !ip.IsLoopback() {
+			Lg.Warnf("Refused %s %s from %s, run with -lan-admin to allow it", r.Method, r.URL.Path, host)
+			writeJSONError(w, http.StatusForbidden, "the admin API only answers this machine, run goeasyjson with -lan-admin to allow "+host)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleQRCode returns a PNG QR code of ?text=, used by the Web UI to open
+// a base URL on a phone.
+func handleQRCode(w http.ResponseWriter, r *http.Request) {
+	text := r.URL.Query().Get("text")
+	if text == "" || len(text) > 1024 {
+		writeJSONError(w, http.StatusBadRequest, "text must be 1 to 1024 characters")
+		return
+	}
+	png, err := qrcode.Encode(text, qrcode.Medium, 256)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "max-age=3600")
+	w.Write(png)
+}
+
+// handleAddresses lists the base URLs of the server.
+func handleAddresses(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"host": bindHost, "urls": reachableURLs()})
+}
+
+func registerLANAdmin(admin *mux.Router) {
+	admin.HandleFunc("/qr", handleQRCode).Methods("GET")
+	admin.HandleFunc("/addresses", handleAddresses).Methods("GET")
+}
@@ -12,36 +12,33 @@ Mobile: +86-13692277450
 HomePage: www.pavogroup.top , github.com/13692277450
 */
 import (
+	"crypto/tls"
 	"embed"
 	"encoding/json"
 	"flag"
 	"fmt"
+	"html/template"
 	"io/fs"
 	"io/ioutil"
 	"log"
-	"math"
-	"math/rand"
+	"net"
 	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
 
-	"github.com/brianvoe/gofakeit/v7"
 	"github.com/charmbracelet/lipgloss"
 	"github.com/fsnotify/fsnotify"
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/mux"
-	"github.com/gorilla/websocket"
 )
 
 //go:embed static/* templates/*
 var staticFiles embed.FS
-var StringEvent string = ""
 
 // getStaticFS returns a filesystem for the static files
 func getStaticFS() http.FileSystem {
@@ -52,15 +49,62 @@ func getStaticFS() http.FileSystem {
 	return http.FS(staticFS)
 }
 
+// getTemplates parses the embedded HTML templates, so the Web UI works
+// without a templates folder next to the program.
+func getTemplates() *template.Template {
+	return template.Must(template.ParseFS(staticFiles, "templates/*.html"))
+}
+
 var (
 	router     *mux.Router
 	routes     = make(map[string]bool)
+	routeFiles = make(map[string]string) // route -> file serving it
 	routesLock sync.RWMutex
 	port       int
 	watcher    *fsnotify.Watcher
 	genjson    string
 	out        string
 	qty        int
+	seed       uint64
+	correlate  bool
+
+	samplesDir    string
+	uniqueFields  string
+	autoIncrement string
+	format        string
+	dialect       string
+	table         string
+	batchSize     int
+	openapiFile   string
+	strictShape   bool
+	proxyTarget   string
+	recordMode    bool
+	recordQuery   string
+	recordHeaders string
+	redactHeaders string
+	tlsEnabled    bool
+	tlsCertFile   string
+	tlsKeyFile    string
+	enableHTTP2   bool
+	redirectPort  int
+	authFile      string
+
+	corsOrigins     string
+	corsMethods     string
+	corsHeaders     string
+	corsExpose      string
+	corsCredentials bool
+	corsMaxAge      time.Duration
+
+	bindHost   string
+	allowCIDRs string
+	denyCIDRs  string
+	lanAdmin   bool
+
+	rateLimitFlag string
+	rateBurst     int
+	rateBy        string
+	quotaFlag     int
 )
 
 var Red = lipgloss.NewStyle().Foreground(lipgloss.Color("#b507eaff"))
@@ -93,117 +137,246 @@ func init() {
 	flag.StringVar(&genjson, "genjson", "", "Generate test JSON data from sample file (e.g. -genjson sample.json -out test.json -qty 1000)")
 	flag.StringVar(&out, "out", "", "Output file for generated JSON data")
 	flag.IntVar(&qty, "qty", 0, "Number of records to generate")
+	flag.Uint64Var(&seed, "seed", 0, "Seed for reproducible fake data, 0 means random")
+	flag.StringVar(&uniqueFields, "unique", "", "Fields whose generated values must be unique (e.g. -unique email,username)")
+	flag.StringVar(&autoIncrement, "autoinc", "", "Auto-increment integer fields as field[:start[:step]] (e.g. -autoinc id:1000:10)")
+	flag.StringVar(&format, "format", "", "Output format of generated data: json, ndjson, csv, sql, parquet or yaml (default from -out extension)")
+	flag.StringVar(&dialect, "dialect", "postgres", "SQL dialect for -format sql: postgres, mysql or sqlite")
+	flag.StringVar(&table, "table", "", "Table name for -format sql (default is the -out file name)")
+	flag.IntVar(&batchSize, "batch", 500, "Rows per INSERT statement for -format sql")
+	flag.BoolVar(&correlate, "correlate", false, "Generate name/email/username and city/state/country/zip from one fake identity per record")
+	flag.StringVar(&samplesDir, "samples", "samples", "Folder of *.sample.json files served as endpoints generating fresh fake data")
+	flag.StringVar(&openapiFile, "openapi", "", "OpenAPI 3 specification (JSON or YAML) whose operations are mocked (e.g. -openapi spec.yaml)")
+	flag.BoolVar(&strictShape, "strict", false, "Validate POST/PUT/PATCH bodies of routes without a .schema.json against the shape of their file")
+	flag.StringVar(&proxyTarget, "proxy", "", "Forward requests without a JSON route to this upstream (e.g. -proxy https://staging.example.com)")
+	flag.BoolVar(&recordMode, "record", false, "Proxy every request to the -proxy upstream and save the responses as JSON files and rules")
+	flag.StringVar(&recordQuery, "record-query", "", "Query parameters telling recorded responses apart (e.g. -record-query role,page)")
+	flag.StringVar(&recordHeaders, "record-headers", "", "Request headers telling recorded responses apart (e.g. -record-headers Accept-Language)")
+	flag.StringVar(&redactHeaders, "redact", "Authorization,Proxy-Authorization,Cookie,Set-Cookie,X-Api-Key,X-Auth-Token", "Headers and query parameters whose recorded values are redacted")
+	flag.BoolVar(&tlsEnabled, "tls", false, "Serve HTTPS with a certificate signed by a local CA generated on the first run")
+	flag.StringVar(&tlsCertFile, "cert", "", "Certificate file for HTTPS instead of the generated one (use with -key)")
+	flag.StringVar(&tlsKeyFile, "key", "", "Private key file of -cert")
+	flag.BoolVar(&enableHTTP2, "http2", true, "Offer HTTP/2 to HTTPS clients")
+	flag.IntVar(&redirectPort, "redirect-port", 0, "With -tls, redirect plain HTTP requests on this port to HTTPS (e.g. -redirect-port 2005)")
+	flag.StringVar(&authFile, "auth", "", "Auth settings (API keys, users, OAuth2 clients, protected routes) enabling the mock OAuth2 provider (e.g. -auth auth.json)")
+	flag.StringVar(&corsOrigins, "cors", "", "Browser origins allowed to call the routes, with wildcards (e.g. -cors http://localhost:*,https://*.example.com or -cors *)")
+	flag.StringVar(&corsMethods, "cors-methods", "GET,POST,PUT,PATCH,DELETE,OPTIONS", "Methods allowed by CORS preflight responses")
+	flag.StringVar(&corsHeaders, "cors-headers", "", "Request headers allowed by CORS preflight responses, empty allows the requested ones")
+	flag.StringVar(&corsExpose, "cors-expose", "X-Total-Count,X-GoEasyJson-Rule,X-GoEasyJson-Proxy,X-RateLimit-Limit,X-RateLimit-Remaining,X-RateLimit-Reset,Retry-After", "Response headers readable by cross-origin scripts")
+	flag.BoolVar(&corsCredentials, "cors-credentials", false, "Allow cross-origin requests with cookies and Authorization headers")
+	flag.DurationVar(&corsMaxAge, "cors-max-age", 10*time.Minute, "How long browsers cache CORS preflight responses")
+	flag.StringVar(&bindHost, "host", JsonAddress, "Address to listen on, 0.0.0.0 to reach the mocks from other devices of the LAN")
+	flag.StringVar(&allowCIDRs, "allow", "", "Only serve these client networks besides this machine (e.g. -allow 192.168.1.0/24,10.0.0.5)")
+	flag.StringVar(&denyCIDRs, "deny", "", "Never serve these client networks (e.g. -deny 192.168.1.13)")
+	flag.BoolVar(&lanAdmin, "lan-admin", false, "Serve the Web UI events and the /__admin API to other machines too")
+	flag.StringVar(&rateLimitFlag, "rate-limit", "", "Requests allowed per client and period, others get 429 (e.g. -rate-limit 10/s or 100/m)")
+	flag.IntVar(&rateBurst, "rate-burst", 0, "Requests a client may send at once, the requests of one period by default")
+	flag.StringVar(&rateBy, "rate-by", "ip", "Client the rate limit counts for: ip, key (API key or Authorization header) or route")
+	flag.IntVar(&quotaFlag, "quota", 0, "Requests allowed per client and day, 0 for no quota")
 	flag.IntVar(&port, "port", 2006, "Server port (e.g. goeasyjson -port 2006)")
 
 }
 
-// 定义一个函数来安全地更新StringEvent并广播
-// Declare Broadcast channel for event updates (moved earlier)
-var Broadcast = make(chan string) // 广播通道
-
-// 收集所有端点URL
-var UpdateStringEvent = func(newEvent string) {
-	var endpoints []string
-	routesLock.RLock()
-	for route := range routes {
-		endpoints = append(endpoints, "http://localhost:"+strconv.Itoa(port)+route)
+// Scan files and update routes based on JSON files in the current directory.
+func scanDirectory() {
+	newRoutes, err := collectRoutes()
+	if err != nil {
+		Lg.Errorf("Error reading directory: %v", err)
+		return
 	}
-	routesLock.RUnlock()
 
-	// 构建JSON响应
-	response := map[string][]string{
-		"endpoints": endpoints,
-	}
+	// Update routes
 
-	// 将JSON序列化后发送
-	jsonData, err := json.Marshal(response)
-	if err != nil {
-		log.Printf("Error marshaling JSON: %v", err)
+	updateRoutes(newRoutes)
+}
+
+// scanDelay groups the file events of a burst, e.g. a git checkout or an
+// import, into one scan of the folder.
+const scanDelay = 300 * time.Millisecond
+
+var (
+	scanLock  sync.Mutex
+	scanTimer *time.Timer
+	afterScan []func()
+)
+
+// requestScan scans the folder once no file event came for scanDelay, then
+// calls the given functions.
+func requestScan(then ...func()) {
+	scanLock.Lock()
+	defer scanLock.Unlock()
+	afterScan = append(afterScan, then...)
+	if scanTimer != nil && scanTimer.Stop() {
+		scanTimer.Reset(scanDelay)
 		return
 	}
-
-	// 发送结构化数据
-	Broadcast <- string(jsonData)
+	var timer *time.Timer
+	timer = time.AfterFunc(scanDelay, func() {
+		scanLock.Lock()
+		callbacks := afterScan
+		afterScan = nil
+		if scanTimer == timer {
+			scanTimer = nil
+		}
+		scanLock.Unlock()
+		scanDirectory()
+		for _, callback := range callbacks {
+			callback()
+		}
+	})
+	scanTimer = timer
 }
 
-// Scan files and update routes based on JSON files in the current directory.
-func scanDirectory() {
+// collectRoutes maps the route of every JSON file below the current directory
+// and of every sample to its file.
+func collectRoutes() (map[string]string, error) {
 	currentDir, err := os.Getwd()
 	if err != nil {
-		Lg.Errorf("Error getting current directory: %v", err)
-		return
+		return nil, err
 	}
 	Lg.Infof("Current directory: %s", currentDir)
 	Lg.Info("Scanning directory for JSON files...")
 
-	files, err := ioutil.ReadDir(currentDir)
-	if err != nil {
-		Lg.Errorf("Error reading directory: %v", err)
-		return
-	}
+	newRoutes := make(map[string]string)
 
-	newRoutes := make(map[string]bool)
-
-	for _, file := range files {
+	// Folders give nested routes, users/[id].json is served at /users/{id}
+	err = filepath.Walk(currentDir, func(path string, file os.FileInfo, err error) error {
+		if err != nil {
+			Lg.Warnf("Error reading %s: %v", path, err)
+			return nil
+		}
 		if file.IsDir() {
-			continue // bypass files in directories
+			if path != currentDir && skipServedDir(path, file) {
+				return filepath.SkipDir // bypass hidden folders and the sample folder
+			}
+			return nil
 		}
 
 		ext := strings.ToLower(filepath.Ext(file.Name()))
 		if excludedExtensions[ext] {
-			continue // bypass excluded file extensions
+			return nil // bypass excluded file extensions
 		}
 
 		// For JSON file create route
 
-		if strings.ToLower(ext) == ".json" {
-			routePath := "/" + strings.TrimSuffix(file.Name(), ext)
-			newRoutes[routePath] = true
+		if strings.ToLower(ext) == ".json" && !isSchemaFile(file.Name()) && !isRulesFile(file.Name()) && !isAuthFile(path) {
+			rel, err := filepath.Rel(currentDir, path)
+			if err != nil {
+				return nil
+			}
+			routePath := routeForPath(rel)
+			if name := filepath.Base(rel); name == rel && strings.HasPrefix(name, "[") {
+				Lg.Warnf("%s is served at %s, parameter files only work inside a folder", rel, routePath)
+			}
+			if existing, ok := newRoutes[routePath]; ok {
+				// chat.ws.json and users/_id.json give way to chat.json and users/[id].json
+				if isWebSocketMockFile(rel) || strings.HasPrefix(filepath.Base(rel), "_") {
+					Lg.Warnf("%s is ignored, route %s is already served by %s", rel, routePath, existing)
+					return nil
+				}
+				Lg.Warnf("%s is ignored, route %s is already served by %s", existing, routePath, rel)
+			}
+			newRoutes[routePath] = rel
+			loadMockRules(rel) // reports invalid rules files when they are added
 		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Update routes
-
-	updateRoutes(newRoutes)
+	// Sample files generate fresh fake data on every request
+	scanSampleDirectory(newRoutes)
+	return newRoutes, nil
 }
 
-// Update routes configuration based on new routes.
-func updateRoutes(newRoutes map[string]bool) {
+// Update routes configuration based on new routes, newRoutes maps each route to its file.
+func updateRoutes(newRoutes map[string]string) {
+	var events []Event
 	routesLock.Lock()
-	defer routesLock.Unlock()
 
 	// Add new routes
-	for route := range newRoutes {
+	for route, file := range newRoutes {
+		routeFiles[route] = file
 		if !routes[route] {
 			log.Printf("Adding new route: %s", route)
 			Lg.Infof("Adding new route: %s", route)
-			//UpdateStringEvent(fmt.Sprintf("Adding new route: %s", routes) + " \n ")
 
-			router.HandleFunc(route, createFileHandler(route)).Methods("GET")
+			if !isPatternRoute(route) {
+				fileRouter.HandleFunc(route, createFileHandler(route)).Methods("GET")
+				fileRouter.HandleFunc(route, createWriteHandler(route)).Methods("POST", "PUT", "PATCH")
+				fileRouter.HandleFunc(route+streamSuffix, createStreamHandler(route)).Methods("GET")
+				fileRouter.HandleFunc(route, createRuleHandler(route)) // DELETE, HEAD... answered by rules
+			}
 			routes[route] = true
+			events = append(events, newEvent(EventRouteAdded, newRouteInfo(route, file)))
 		}
 	}
 
 	// Remote routes that no longer exist
 	for route := range routes {
-		if !newRoutes[route] {
+		if _, ok := newRoutes[route]; !ok {
 			Lg.Infof("Route %s no longer exists", route)
 
+			events = append(events, newEvent(EventRouteRemoved, newRouteInfo(route, routeFiles[route])))
 			delete(routes, route)
+			delete(routeFiles, route)
 		}
 	}
+	routePatterns = buildRoutePatterns(routes)
+	routesLock.Unlock()
+
+	if len(events) > 0 {
+		invalidateGraphQLSchema()
+	}
+
+	// Publish after unlocking, WebSocket snapshots read the routes too
+	for _, event := range events {
+		publishEvent(event.Type, event.Data)
+	}
 }
 
 // File process
 func createFileHandler(route string) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		filename := strings.TrimPrefix(route, "/") + ".json"
+		routesLock.RLock()
+		filename, ok := routeFiles[route]
+		routesLock.RUnlock()
+		if !ok {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		if !isWebSocketMockFile(filename) {
+			var handled bool
+			if w, handled = serveMatchingRule(w, r, filename, nil, http.StatusOK); handled {
+				return
+			}
+		}
+		if isSampleFile(filename) {
+			serveGeneratedRecords(w, r, filename)
+			return
+		}
+		if isWebSocketMockFile(filename) {
+			serveWebSocketMock(w, r, filename)
+			return
+		}
+
 		content, err := ioutil.ReadFile(filename)
 		if err != nil {
 			Lg.Errorf("Error reading file %s: %v", filename, err)
 			http.Error(w, "File not found", http.StatusNotFound)
 			return
 		}
+		if (isPatternRoute(route) || authPrincipalFrom(r) != nil) && strings.Contains(string(content), "{{") {
+			// users/[id].json may answer with {"id": "{{path.id}}", "name": "{{fake.name}}"}, or {{claims.sub}} with -auth
+			var template interface{}
+			if err := json.Unmarshal(content, &template); err == nil {
+				rendered := newTemplateContext(newRuleRequest(r, nil).values).renderTemplate(template)
+				if data, err := json.Marshal(rendered); err == nil {
+					content = data
+				}
+			}
+		}
 
 		// Setup response headers
 		w.Header().Set("Content-Type", "application/json")
@@ -214,8 +387,24 @@ func createFileHandler(route string) http.HandlerFunc {
 	}
 }
 
+// watchSubfolders adds watches for the folders below dir that serve routes.
+func watchSubfolders(dir string) {
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || !info.IsDir() || path == dir {
+			return nil
+		}
+		if skipServedDir(path, info) {
+			return filepath.SkipDir
+		}
+		if err := watcher.Add(path); err != nil {
+			Lg.Warnf("Failed to add watch for directory %s: %v", path, err)
+		}
+		return nil
+	})
+}
+
 // Initialize file watcher and start monitoring for JSON files only.
-func initFileWatcher(UpdateStringEvent func(string)) error {
+func initFileWatcher() error {
 	var err error
 	watcher, err = fsnotify.NewWatcher()
 	if err != nil {
@@ -233,10 +422,20 @@ func initFileWatcher(UpdateStringEvent func(string)) error {
 	if err != nil {
 		return fmt.Errorf("failed to add watch for directory %s: %v", currentDir, err)
 	}
+	// and for its folders, which serve nested routes
+	watchSubfolders(currentDir)
+
+	// Add watch for the sample folder of generated endpoints
+	if info, err := os.Stat(samplesDir); err == nil && info.IsDir() {
+		if err := watcher.Add(samplesDir); err != nil {
+			Lg.Warnf("Failed to add watch for sample folder %s: %v", samplesDir, err)
+		}
+	}
 
 	log.Printf("File watcher initialized, monitoring directory %s for JSON files only", currentDir)
 	Lg.Info("File watcher initialized, monitoring directory for JSON files only")
 	lastEvent := make(map[string]fsnotify.Op)
+	pendingWrites := make(map[string]*time.Timer)
 
 	// Start file watcher event loop
 	go func() {
@@ -257,17 +456,18 @@ func initFileWatcher(UpdateStringEvent func(string)) error {
 						if info, err := os.Stat(event.Name); err == nil {
 							if !info.IsDir() {
 								// New json file was created, add watch for it
+								_, existed := routeForFile(event.Name)
 								err := watcher.Add(event.Name)
 								if err != nil {
 									Lg.Errorf("Failed to add watch for new JSON file %s: %v", event.Name, err)
 									log.Printf("Failed to add watch for new JSON file %s: %v", event.Name, err)
-									UpdateStringEvent(event.Name + " \n ")
 								} else {
 									Lg.Infof("Added watch for new JSON file: %s", event.Name)
 									log.Printf("Added watch for new JSON file: %s", event.Name)
-									UpdateStringEvent(event.Name + " \n ")
 
-									scanDirectory()
+									// A file replaced by rename (e.g. saved from the Web UI) is a change
+									name := event.Name
+									requestScan(func() { checkChangedFile(name, existed) })
 								}
 							}
 						}
@@ -280,19 +480,23 @@ func initFileWatcher(UpdateStringEvent func(string)) error {
 							log.Printf("Detected changes in JSON file: %s", event.Name)
 						}
 						// delayed scan to avoid rapid consecutive changes
-						time.AfterFunc(600*time.Millisecond, func() {
-							scanDirectory()
-						})
+						if timer, ok := pendingWrites[event.Name]; ok {
+							timer.Reset(600 * time.Millisecond)
+						} else {
+							name := event.Name
+							pendingWrites[name] = time.AfterFunc(600*time.Millisecond, func() {
+								requestScan(func() { checkChangedFile(name, true) })
+							})
+						}
 					case fsnotify.Remove:
 						if lastOp, exists := lastEvent[event.Name]; !exists || lastOp != event.Op {
 							lastEvent[event.Name] = event.Op
 						} else {
 							Lg.Infof("JSON file removed: %s", event.Name)
 							log.Printf("JSON file removed: %s", event.Name)
-							UpdateStringEvent(event.Name + " \n ")
 						}
 						// json file was removed, remove watch
-						scanDirectory()
+						requestScan()
 					case fsnotify.Rename:
 						if lastOp, exists := lastEvent[event.Name]; !exists || lastOp != event.Op {
 							lastEvent[event.Name] = event.Op
@@ -300,7 +504,7 @@ func initFileWatcher(UpdateStringEvent func(string)) error {
 							Lg.Infof("JSON file renamed: %s", event.Name)
 							log.Printf("JSON file renamed: %s", event.Name)
 						}
-						scanDirectory()
+						requestScan()
 					}
 				} else if event.Op&fsnotify.Create == fsnotify.Create {
 					// Process new folder
@@ -312,8 +516,16 @@ func initFileWatcher(UpdateStringEvent func(string)) error {
 								Lg.Warnf("Failed to add watch for new directory %s: %v", event.Name, err)
 								log.Printf("Failed to add watch for new directory %s: %v", event.Name, err)
 							}
+							// A folder moved in may already hold JSON files
+							if !skipServedDir(event.Name, info) {
+								watchSubfolders(event.Name)
+							}
+							requestScan()
 						}
 					}
+				} else if event.Op&(fsnotify.Remove|fsnotify.Rename) != 0 {
+					// A removed folder takes its routes with it
+					requestScan()
 				}
 
 			case err, ok := <-watcher.Errors:
@@ -328,6 +540,12 @@ func initFileWatcher(UpdateStringEvent func(string)) error {
 	return nil
 }
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		os.Exit(runImport(os.Args[2:]))
+	}
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		os.Exit(runExport(os.Args[2:]))
+	}
 	flag.Parse()
 
 	// Check if we need to generate JSON data
@@ -344,6 +562,17 @@ func main() {
 	fmt.Println("Just put your new Json file in the same directory as this program,\nit will be served automatically.")
 	fmt.Println("")
 	fmt.Println(Red.Render("Fake data generator: goeasyjson -genjson sample.json -out test.json -qty 1000."))
+	fmt.Println(Red.Render("Generated endpoints: put *.sample.json files into the samples folder, e.g. /users?count=100&seed=1."))
+	fmt.Println(Red.Render("Mock an OpenAPI specification: goeasyjson -openapi spec.yaml."))
+	fmt.Println(Red.Render("Validate POST/PUT/PATCH bodies: add users.schema.json next to users.json, or run goeasyjson -strict."))
+	fmt.Println(Red.Render("Mock a few routes of a real backend: goeasyjson -proxy https://staging.example.com."))
+	fmt.Println(Red.Render("Record mock files from a real backend: goeasyjson -record -proxy https://staging.example.com."))
+	fmt.Println(Red.Render("Share the mocks: goeasyjson export postman|har|openapi|curl, or import har|postman file."))
+	fmt.Println(Red.Render("Serve HTTPS with a local CA: goeasyjson -tls, or your own certificate: -cert cert.pem -key key.pem."))
+	fmt.Println(Red.Render("Protect routes with API keys, Basic auth or JWTs from /oauth/token: goeasyjson -auth auth.json."))
+	fmt.Println(Red.Render("Call the routes from an app on another port: goeasyjson -cors http://localhost:*."))
+	fmt.Println(Red.Render("Simulate API throttling: goeasyjson -rate-limit 10/s -quota 1000."))
+	fmt.Println(Red.Render("Open the mocks to phones on the LAN: goeasyjson -host 0.0.0.0 -allow 192.168.1.0/24."))
 	fmt.Println(Red.Render("Customize API port: goeasyjson -port 2006."))
 	fmt.Println(Red.Render("Upgrade to new version: goeasyjson -upgrade."))
 
@@ -359,6 +588,51 @@ func main() {
 		DownlaodOption() // download new version
 		os.Exit(0)
 	}
+	if openapiFile != "" {
+		spec, err := loadMockSpec(openapiFile)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		mockSpec = spec
+	}
+	if recordMode && proxyTarget == "" {
+		log.Fatalf("-record needs the upstream to record, e.g. -record -proxy https://staging.example.com")
+	}
+	if tlsCertFile != "" || tlsKeyFile != "" {
+		tlsEnabled = true
+	}
+	var tlsConfig *tls.Config
+	if tlsEnabled {
+		config, err := newTLSConfig()
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		tlsConfig = config
+	}
+	var err error
+	if allowedNets, err = parseIPList(allowCIDRs); err != nil {
+		log.Fatalf("-allow: %v", err)
+	}
+	if deniedNets, err = parseIPList(denyCIDRs); err != nil {
+		log.Fatalf("-deny: %v", err)
+	}
+	if limit := globalRateLimit(); limit != nil {
+		if err := limit.validate(); err != nil {
+			log.Fatalf("-rate-limit: %v", err)
+		}
+	}
+	if authFile != "" {
+		if _, err := loadAuthConfig(); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	if proxyTarget != "" {
+		handler, err := newProxyHandler(proxyTarget)
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+		proxyHandler = handler
+	}
 	if _, err := os.Stat("goeasyjson.exe.old"); os.IsNotExist(err) {
 	} else {
 		os.Remove("goeasyjson.exe.old")
@@ -374,13 +648,16 @@ func main() {
 		os.Remove("goeasyjsonMacVersion.old")
 		fmt.Printf("The old version application was removed success.\n")
 	}
-	// Initialize router
+	// Initialize router, routes of files come first and routes with parameters last
 	router = mux.NewRouter()
+	fileRouter = router.NewRoute().Subrouter()
 
-	// Define UpdateStringEvent function before usage (moved earlier)
+	// Start delivering WebSocket events before the first scan publishes routes
+	go hub.run()
 
 	// Initialize file watcher and start monitoring for changes.
-	err := initFileWatcher(UpdateStringEvent)
+	err = initFileWatcher()
+	watching := err == nil
 	if err != nil {
 		log.Printf("Failed to initialize file watcher: %v", err)
 		log.Println("Falling back to periodic scanning only")
@@ -398,15 +675,18 @@ func main() {
 	// 	versionChan <- NewVersionCheck()
 	// }()
 
-	// Setup periodic scanning every 60 seconds as backup solution
-	ticker := time.NewTicker(180 * time.Second)
-	defer ticker.Stop()
+	// Setup periodic scanning every 180 seconds when the file watcher could not
+	// start, walking the whole tree is only worth it then
+	if !watching {
+		ticker := time.NewTicker(180 * time.Second)
+		defer ticker.Stop()
 
-	go func() {
-		for range ticker.C {
-			scanDirectory()
-		}
-	}()
+		go func() {
+			for range ticker.C {
+				scanDirectory()
+			}
+		}()
+	}
 
 	// Add health check endpoint
 	router.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
@@ -419,80 +699,59 @@ func main() {
 	staticFS := getStaticFS()
 	router.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(staticFS)))
 
-	// WebSocket连接管理
-	var clients = make(map[*websocket.Conn]bool) // 已连接的客户端
-	// Broadcast channel already declared earlier
+	// GraphQL endpoint generated from the served files, browsers get GraphiQL
+	router.HandleFunc(graphqlPath, handleGraphQL)
 
-	// WebSocket升级器
-	var upgrader = websocket.Upgrader{
-		CheckOrigin: func(r *http.Request) bool {
-			return true // 允许所有来源
-		},
-	}
+	// OpenAPI document of the current routes and its Swagger UI page
+	router.HandleFunc(openAPIPath, handleOpenAPI).Methods("GET")
+	router.HandleFunc(apiDocsPath, handleAPIDocs).Methods("GET")
 
-	// 处理WebSocket连接
-	router.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
-		// 升级HTTP连接为WebSocket连接
-		conn, err := upgrader.Upgrade(w, r, nil)
-		if err != nil {
-			log.Println(err)
-			return
-		}
-		defer conn.Close()
+	// Management API used by the Web UI
+	registerAdminRoutes(router)
 
-		// 注册新客户端
-		clients[conn] = true
-		log.Println("New WebSocket client connected")
-
-		// 发送当前的StringEvent值
-		conn.WriteMessage(websocket.TextMessage, []byte(StringEvent))
+	// Token endpoint of the mock OAuth2 provider
+	if authFile != "" {
+		registerAuthRoutes(router)
+	}
 
-		// 监听客户端断开连接
-		for {
-			_, _, err := conn.ReadMessage()
-			if err != nil {
-				log.Println("WebSocket client disconnected")
-				delete(clients, conn)
-				break
-			}
-		}
-	})
+	// Operations of the OpenAPI specification given with -openapi
+	if mockSpec != nil {
+		registerSpecRoutes(router, mockSpec)
+	}
 
-	// 广播消息给所有客户端
-	go func() {
-		for {
-			// 等待新消息
-			msg := <-Broadcast
-			// 发送给所有客户端
-			for client := range clients {
-				err := client.WriteMessage(websocket.TextMessage, []byte(msg))
-				if err != nil {
-					log.Println(err)
-					client.Close()
-					delete(clients, client)
-				}
-			}
-		}
-	}()
-	// 使用函数更新事件（已包含排序逻辑）
-	UpdateStringEvent("")
+	// 处理WebSocket连接
+	router.HandleFunc("/ws", handleWebSocket)
+	go reportServerStatus(30 * time.Second)
 
 	// Start the server
 	log.Printf("Starting server on port %d...", port)
-	var strPort = fmt.Sprintf("Access JSON API at http://localhost:%d/filename-without-extension\n", port)
-	fmt.Println(LightYellow.Render(strPort))
+	for _, base := range reachableURLs() {
+		var strPort = fmt.Sprintf("Access JSON API at %s/filename-without-extension", base)
+		fmt.Println(LightYellow.Render(strPort))
+	}
+	if ip := net.ParseIP(bindHost); ip != nil && ip.IsUnspecified() && allowCIDRs == "" {
+		fmt.Println(LightYellow.Render("Every device of the network can reach the server, limit them with -allow 192.168.1.0/24."))
+	} else if displayHost() == "localhost" && bindHost != "" {
+		fmt.Println("Only this machine can reach the server, run with -host 0.0.0.0 to open it to the LAN.")
+	}
+	if !loopbackBind() && lanAdmin {
+		fmt.Println(LightYellow.Render("Other devices can use the /__admin API too: they can edit and delete the mock files."))
+	} else if !loopbackBind() {
+		fmt.Println("The /__admin API and the Web UI events only answer this machine, run with -lan-admin to manage the mocks from other devices.")
+	}
+	fmt.Println("")
 	fmt.Println("Server will automatically update routes when JSON files are added/removed/modified")
 
 	// 设置Gin为release模式，禁用调试输出
 	gin.SetMode(gin.ReleaseMode)
 	r := gin.Default()
-	r.LoadHTMLGlob("templates/*")
+	r.SetHTMLTemplate(getTemplates())
 	r.GET("/", func(c *gin.Context) {
 		// 收集所有端点URL
 		var endpoints []string
 		routesLock.RLock()
 		for route := range routes {
-			endpoints = append(endpoints, "http://localhost:"+strconv.Itoa(port)+route)
+			endpoints = append(endpoints, serverURL()+route)
 		}
 		routesLock.RUnlock()
 
@@ -506,11 +765,51 @@ func main() {
 		r.ServeHTTP(w, req)
 	})
 
-	err = http.ListenAndServe(":"+strconv.Itoa(port), router)
+	// Files such as users/[id].json, matched after every other route
+	router.MatcherFunc(matchRoutePattern).HandlerFunc(serveRoutePattern)
+
+	// Everything else goes to the -proxy upstream
+	if proxyHandler != nil {
+		router.NotFoundHandler = proxyHandler
+		router.MethodNotAllowedHandler = proxyHandler
+		log.Printf("Requests without a JSON route are proxied to %s", proxyTarget)
+		Lg.Infof("Requests without a JSON route are proxied to %s", proxyTarget)
+	}
+
+	var handler http.Handler = router
+	if recordMode {
+		handler = recordRequests(router)
+		log.Printf("Recording the responses of %s", proxyTarget)
+		Lg.Infof("Recording the responses of %s", proxyTarget)
+	}
+	if authFile != "" {
+		handler = requireAuth(handler)
+	}
+	handler = limitRate(handler)
+	handler = handleCORS(handler) // preflights are answered before auth, they carry no credentials
+	server := &http.Server{Addr: listenAddress(port), Handler: restrictClients(inspectRequests(handler))}
+	server.RegisterOnShutdown(stopEventStreams)
+	go shutdownOnSignal(server)
+
+	if tlsEnabled {
+		server.TLSConfig = tlsConfig
+		if !enableHTTP2 {
+			server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+		}
+		if redirectPort != 0 {
+			go serveHTTPSRedirect(redirectPort)
+		}
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if err == http.ErrServerClosed {
+		return
+	}
 	if err != nil {
 		log.Printf("Server error: %v", err)
 	}
-	var urlString = "http://localhost:" + strconv.Itoa(port)
+	var urlString = serverURL()
 
 	// err = browser.OpenURL(urlString)
 	// if err != nil {
@@ -554,197 +853,35 @@ func generateTestData(sampleFile, outputFile string, quantity int) {
 		log.Fatalf("Error parsing sample JSON: %v", err)
 	}
 
+	gen, err := newGeneratorFromFlags()
+	if err != nil {
+		log.Fatalf("Error in generator options: %v", err)
+	}
+
 	// Generate test data
 	var results []interface{}
 	for i := 0; i < quantity; i++ {
-		// Deep copy sample structure for each record
-		sampleCopy, _ := json.Marshal(sample)
-		var record interface{}
-		_ = json.Unmarshal(sampleCopy, &record)
-		record = fillDynamic(record, "")
-		results = append(results, record)
+		results = append(results, gen.NewRecord(sample))
 	}
 
 	// Write generated data to output file
-	outputData, err := json.MarshalIndent(results, "", "  ")
-	if err != nil {
-		log.Fatalf("Error marshaling generated data: %v", err)
-	}
-
-	if err := ioutil.WriteFile(outputFile, outputData, 0644); err != nil {
+	opts := OutputOptions{Format: strings.ToLower(format), Dialect: dialect, Table: table, BatchSize: batchSize}
+	if err := writeGeneratedData(outputFile, results, opts); err != nil {
 		log.Fatalf("Error writing output file: %v", err)
 	}
 
 	fmt.Printf("Successfully generated %d records and saved to %s\n", quantity, outputFile)
 }
 
-func fillDynamic(v interface{}, key string) interface{} {
-	switch vv := v.(type) {
-	case map[string]interface{}:
-		for k, val := range vv {
-			vv[k] = fillDynamic(val, k)
-		}
-		return vv
-	case []interface{}:
-		for i, item := range vv {
-			vv[i] = fillDynamic(item, "")
-		}
-		return vv
-	case string:
-		switch strings.ToLower(key) {
-		case "name", "username", "firstname", "lastname":
-			return gofakeit.Name()
-		// case "number":
-		// 	if _, ok := v.(int); ok {
-		// 		// 整数类型，生成相同位数的随机整数
-		// 		return (func() int {
-		// 			numDigits := 10 // 根据需要调整位数
-		// 			min := int(math.Pow10(numDigits - 1))
-		// 			max := int(math.Pow10(numDigits)) - 1
-		// 			return rand.Intn(max-min+1) + min
-		// 		})()
-		// 	}
-		// 	// 如果不是int类型，则返回字符串格式的随机数字
-		// 	return fmt.Sprintf("%d", rand.Intn(9000000000)+1000000000)
-
-		case "email":
-			return gofakeit.Email()
-		// case "grade":
-		// 	return rand.Intn(100) // Grade between 1 and 100
-		// case "age":
-		// 	return rand.Intn(100) // Age between 1 and 99
-		case "gender":
-			return gofakeit.Gender()
-		case "address":
-			return gofakeit.Address()
-		case "phone", "telephone":
-			return gofakeit.Phone()
-		case "city":
-			return gofakeit.City()
-		case "country":
-			return gofakeit.Country()
-		case "state":
-			return gofakeit.State()
-		case "streetaddress":
-			return gofakeit.Street()
-		case "zipcode", "postcode":
-			return gofakeit.Zip()
-		case "company":
-			return gofakeit.Company()
-		case "jobtitle", "title":
-			return gofakeit.JobTitle()
-		case "date", "dob", "birthdate":
-			return gofakeit.Date().Format("2006-01-02")
-		case "datetime", "timestamp":
-			return gofakeit.Date().Format(time.RFC3339)
-		case "url", "website":
-			return gofakeit.URL()
-		case "color":
-			return gofakeit.Color()
-		case "uuid", "id":
-			return gofakeit.UUID()
-		case "latitude":
-			return gofakeit.Latitude()
-		case "longitude":
-			return gofakeit.Longitude()
-		case "word":
-			return gofakeit.Word()
-		case "sentence":
-			return gofakeit.Sentence()
-		case "paragraph":
-			return gofakeit.Paragraph()
-		case "creditcardnumber":
-			// gofakeit.CreditCardNumber may not be available in all versions; use CreditCard() and return Number field
-			cc := gofakeit.CreditCard()
-			return cc.Number
-		case "creditcardtype":
-			return gofakeit.CreditCardType()
-		case "creditcardexpirationdate":
-			return gofakeit.CreditCardExp()
-		case "creditcardholdername":
-			// return a realistic person name as card holder
-			return gofakeit.Name()
-
-		case "creditcardexpirationmonth":
-			return gofakeit.Month()
-		case "creditcardexpirationyear":
-			return gofakeit.Year()
-		case "quantity":
-			return rand.Intn(1000000) // Quantity between 0 and 999999
-		case "price", "amount":
-			return fmt.Sprintf("%.2f", gofakeit.Price(1, 1000)) // Price between 1.00 and 1000.00
-		case "currency":
-			return gofakeit.CurrencyShort()
-		case "ip":
-			return gofakeit.IPv4Address()
-		case "ipv6":
-			return gofakeit.IPv6Address()
-		case "macaddress":
-			return gofakeit.MacAddress()
-		case "mac":
-			return gofakeit.MacAddress()
-		case "password":
-			return gofakeit.Password(true, true, true, true, true, 12)
-			// Add more cases for other fields as needed...
-		case "day":
-			return gofakeit.Day()
-		case "month":
-			return gofakeit.Month()
-		case "year":
-			return gofakeit.Year()
-		case "companysuffix":
-			return gofakeit.CompanySuffix()
-		case "unit":
-			return gofakeit.Unit()
-		case "area":
-			return rand.Float64() * 10000 // Area between 0.00 and 10000.00
-		case "street":
-			return gofakeit.Street()
-		case "rich":
-			return gofakeit.Bool()
-		default:
-			return gofakeit.Word()
-		}
-	case bool:
-		return rand.Intn(2) == 1
-	default:
-		// 根据源数据类型生成相应长度的随机数
-		switch value := v.(type) {
-		case float64:
-			// 根据原始值的小数位数保留对应位数
-			// 将原始值转换为字符串以确定小数位数
-			str := strconv.FormatFloat(value, 'f', -1, 64)
-			parts := strings.Split(str, ".")
-			decimalPlaces := 0
-			if len(parts) > 1 {
-				decimalPlaces = len(parts[1])
-			}
-
-			// 生成0-100之间的随机数
-			randomValue := rand.Float64() * 100
-
-			// 根据原始小数位数保留对应位数
-			if decimalPlaces > 0 {
-				multiplier := math.Pow10(decimalPlaces)
-				return math.Round(randomValue*multiplier) / multiplier
-			}
-			// 如果是整数，则返回整数
-			return math.Round(randomValue)
-		case int, int8, int16, int32, int64:
-			// 整数类型，生成相同位数的随机整数
-			numDigits := len(fmt.Sprintf("%d", value))
-			min := int(math.Pow10(numDigits - 1))
-			max := int(math.Pow10(numDigits)) - 1
-			return rand.Intn(max-min+1) + min
-		default:
-			// 其他类型，使用原来的逻辑
-			return generateRandomValue(key)
-		}
+// newGeneratorFromFlags creates a fake data generator configured by the command line flags.
+func newGeneratorFromFlags() (*FakeGenerator, error) {
+	gen := NewFakeGenerator(seed)
+	gen.Correlate = correlate
+	gen.Unique = ParseUniqueFields(uniqueFields)
+	sequences, err := ParseSequences(autoIncrement)
+	if err != nil {
+		return nil, err
 	}
-}
-
-func generateRandomValue(key string) interface{} {
-	// Generate a random number and append to key name
-	randNum := rand.Intn(9000000) + 1000000 // 7-digit random number
-	return fmt.Sprintf("%s%d", key, randNum)
+	gen.Sequences = sequences
+	return gen, nil
 }
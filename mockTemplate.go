@@ -0,0 +1,145 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// templatePlaceholder matches {{expression}} placeholders in mock responses.
+var templatePlaceholder = regexp.MustCompile(`\{\{\s*([^{}]+?)\s*\}\}`)
+
+// templateContext holds the values available to the placeholders of a mock response:
+//
+//	{{fake.email}}     a value of a generator rule, see RuleNames
+//	{{now}}            the current time in RFC 3339, {{timestamp}} in Unix milliseconds
+//	{{uuid}}           a random UUID
+//	{{message.a.b}}    a value from Values, e.g. a field of the incoming message
+//
+// Unknown placeholders are left unchanged.
+type templateContext struct {
+	Gen    *FakeGenerator
+	Values map[string]interface{}
+}
+
+func newTemplateContext(values map[string]interface{}) *templateContext {
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+	gen := NewFakeGenerator(0)
+	gen.Correlate = true
+	return &templateContext{Gen: gen, Values: values}
+}
+
+// renderTemplate returns a copy of v with all placeholders in strings replaced.
+// A string that is a single placeholder keeps the type of the value, so
+// "{{fake.quantity}}" renders as a number.
+func (c *templateContext) renderTemplate(v interface{}) interface{} {
+	c.Gen.identity = nil // correlated fake fields describe one person per rendering
+	return c.render(v)
+}
+
+func (c *templateContext) render(v interface{}) interface{} {
+	switch vv := v.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{}, len(vv))
+		for k, item := range vv {
+			out[k] = c.render(item)
+		}
+		return out
+	case []interface{}:
+		out := make([]interface{}, len(vv))
+		for i, item := range vv {
+			out[i] = c.render(item)
+		}
+		return out
+	case string:
+		return c.renderString(vv)
+	}
+	return v
+}
+
+func (c *templateContext) renderString(s string) interface{} {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+	if m := templatePlaceholder.FindStringSubmatchIndex(s); m != nil && m[0] == 0 && m[1] == len(s) {
+		if value, ok := c.lookup(s[m[2]:m[3]]); ok {
+			return value
+		}
+		return s
+	}
+	return c.renderText(s)
+}
+
+// renderText replaces placeholders in s with the text of their values.
+func (c *templateContext) renderText(s string) string {
+	return templatePlaceholder.ReplaceAllStringFunc(s, func(placeholder string) string {
+		expr := templatePlaceholder.FindStringSubmatch(placeholder)[1]
+		value, ok := c.lookup(expr)
+		if !ok {
+			return placeholder
+		}
+		if text, ok := value.(string); ok {
+			return text
+		}
+		return fmt.Sprint(value)
+	})
+}
+
+// lookup evaluates one placeholder expression.
+func (c *templateContext) lookup(expr string) (interface{}, bool) {
+	switch expr {
+	case "now":
+		return time.Now().Format(time.RFC3339), true
+	case "timestamp":
+		return time.Now().UnixMilli(), true
+	case "uuid":
+		return c.Gen.Faker.UUID(), true
+	}
+	if rule, ok := strings.CutPrefix(expr, "fake."); ok {
+		if fn, ok := fakeRules[strings.ToLower(rule)]; ok {
+			return fn(c.Gen), true
+		}
+		return nil, false
+	}
+	return lookupJSONPath(c.Values, expr)
+}
+
+// lookupJSONPath returns the value at a dotted path such as "user.tags.0" in
+// decoded JSON.
+func lookupJSONPath(v interface{}, path string) (interface{}, bool) {
+	for _, part := range strings.Split(path, ".") {
+		switch vv := v.(type) {
+		case map[string]interface{}:
+			item, ok := vv[part]
+			if !ok {
+				return nil, false
+			}
+			v = item
+		case []interface{}:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(vv) {
+				return nil, false
+			}
+			v = vv[i]
+		case []string:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(vv) {
+				return nil, false
+			}
+			v = vv[i]
+		case map[string]string:
+			item, ok := vv[part]
+			if !ok {
+				return nil, false
+			}
+			v = item
+		default:
+			return nil, false
+		}
+	}
+	return v, true
+}
@@ -0,0 +1,405 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	openAPIPath     = "/openapi.json"
+	apiDocsPath     = "/docs"
+	maxExampleItems = 3 // array elements kept in examples
+)
+
+// handleOpenAPI describes the current routes as an OpenAPI 3 document. It is
+// built on every request, so added and removed files show up right away.
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, buildOpenAPIDocument())
+}
+
+// handleAPIDocs serves the Swagger UI page rendering /openapi.json.
+func handleAPIDocs(w http.ResponseWriter, r *http.Request) {
+	page, _ := staticFiles.ReadFile("static/swagger.html")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(page)
+}
+
+func buildOpenAPIDocument() map[string]interface{} {
+	paths := map[string]interface{}{}
+	for _, info := range routeInfos() {
+		path := openAPIRoute(info.Route)
+		switch info.Kind {
+		case "websocket":
+			paths[path] = map[string]interface{}{"get": webSocketOperation(info)}
+		case "sample":
+			paths[path] = withWriteOperations(info, map[string]interface{}{"get": sampleOperation(info)})
+		default:
+			paths[path] = withWriteOperations(info, map[string]interface{}{"get": fileOperation(info)})
+		}
+		if info.Stream != "" {
+			paths[path+streamSuffix] = map[string]interface{}{"get": streamOperation(info)}
+		}
+		if isPatternRoute(info.Route) {
+			addPathParameters(info.Route, paths[path])
+			if item, ok := paths[path+streamSuffix]; ok {
+				addPathParameters(info.Route, item)
+			}
+		}
+	}
+	paths[graphqlPath] = map[string]interface{}{"post": map[string]interface{}{
+		"summary":     "GraphQL API inferred from the JSON files",
+		"operationId": "graphql",
+		"tags":        []string{"graphql"},
+		"requestBody": map[string]interface{}{
+			"required": true,
+			"content": map[string]interface{}{"application/json": map[string]interface{}{
+				"schema": map[string]interface{}{
+					"type":     "object",
+					"required": []string{"query"},
+					"properties": map[string]interface{}{
+						"query":         map[string]interface{}{"type": "string"},
+						"variables":     map[string]interface{}{"type": "object"},
+						"operationName": map[string]interface{}{"type": "string"},
+					},
+				},
+				"example": map[string]interface{}{"query": "{ _routes }"},
+			}},
+		},
+		"responses": map[string]interface{}{"200": jsonResponse("GraphQL result", map[string]interface{}{"type": "object"}, nil)},
+	}}
+	paths["/health"] = map[string]interface{}{"get": map[string]interface{}{
+		"summary":     "Health check",
+		"operationId": "health",
+		"tags":        []string{"server"},
+		"responses": map[string]interface{}{"200": jsonResponse("Server is running",
+			openAPISchema(inferShape(map[string]interface{}{"status": "ok", "message": ""})),
+			map[string]string{"status": "ok", "message": "Server is running"})},
+	}}
+
+	if mockSpec != nil {
+		// Operations mocked from the -openapi specification
+		base := specBasePath(mockSpec)
+		for path, item := range mockSpec.Paths.Map() {
+			if _, exists := paths[base+path]; !exists {
+				paths[base+path] = item
+			}
+		}
+	}
+
+	doc := map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":       "GoEasyJson mock API",
+			"version":     CurrentVersion,
+			"description": "Generated from the JSON files served by GoEasyJson.",
+		},
+		"servers": []map[string]string{{"url": serverURL()}},
+		"paths":   paths,
+	}
+	if mockSpec != nil && mockSpec.Components != nil {
+		doc["components"] = mockSpec.Components // referenced by the mocked operations
+	}
+	return doc
+}
+
+// fileOperation describes a route serving the content of a JSON file.
+func fileOperation(info RouteInfo) map[string]interface{} {
+	op := map[string]interface{}{
+		"summary":     "Content of " + info.File,
+		"operationId": operationID("get", info.Route),
+		"tags":        []string{"files"},
+	}
+	data, err := ioutil.ReadFile(info.File)
+	var content interface{}
+	if err == nil {
+		err = json.Unmarshal(data, &content)
+	}
+	if err != nil {
+		op["responses"] = map[string]interface{}{"200": map[string]interface{}{"description": "Content of " + info.File + " (not valid JSON at the moment)"}}
+		return op
+	}
+	op["responses"] = map[string]interface{}{
+		"200": jsonResponse("Content of "+info.File, openAPISchema(inferShape(content)), exampleValue(content)),
+		"404": map[string]interface{}{"description": "The file was removed"},
+	}
+	addRuleResponses(op, info.File, "GET", http.StatusOK)
+	return op
+}
+
+// sampleOperation describes a route generating fake records from a sample.
+func sampleOperation(info RouteInfo) map[string]interface{} {
+	op := map[string]interface{}{
+		"summary":     "Fake records generated from " + info.File,
+		"operationId": operationID("get", info.Route),
+		"tags":        []string{"generated"},
+		"parameters": []map[string]interface{}{
+			queryParameter("count", "integer", "Size of the whole dataset, default "+strconv.Itoa(defaultSampleCount)),
+			queryParameter("seed", "integer", "Seed for reproducible records"),
+			queryParameter("page", "integer", "Page of the dataset, starting at 1"),
+			queryParameter("limit", "integer", "Records per page"),
+		},
+	}
+	template, err := loadSampleTemplate(info.File)
+	if err != nil {
+		op["responses"] = map[string]interface{}{"200": map[string]interface{}{"description": "Generated records"}}
+		return op
+	}
+	response := jsonResponse("Generated records", openAPISchema(inferShape([]interface{}{template})), []interface{}{template})
+	response["headers"] = map[string]interface{}{"X-Total-Count": map[string]interface{}{
+		"description": "Size of the whole dataset",
+		"schema":      map[string]interface{}{"type": "integer"},
+	}}
+	op["responses"] = map[string]interface{}{
+		"200": response,
+		"400": map[string]interface{}{"description": "Invalid count, seed, page or limit"},
+	}
+	addRuleResponses(op, info.File, "GET", http.StatusOK)
+	return op
+}
+
+// streamOperation describes the Server-Sent Events stream of a route.
+func streamOperation(info RouteInfo) map[string]interface{} {
+	return map[string]interface{}{
+		"summary":     "Server-Sent Events streaming " + info.File,
+		"operationId": operationID("stream", info.Route),
+		"tags":        []string{"streams"},
+		"parameters": []map[string]interface{}{
+			queryParameter("interval", "string", "Time between events, e.g. 500ms"),
+			queryParameter("rate", "number", "Events per second"),
+			queryParameter("loop", "boolean", "Start again after the last element"),
+			queryParameter("count", "integer", "Maximum number of events"),
+			queryParameter("generate", "boolean", "Send fake records based on the elements"),
+			queryParameter("seed", "integer", "Seed for generated records"),
+		},
+		"responses": map[string]interface{}{"200": map[string]interface{}{
+			"description": `"record", "changed" and "end" events`,
+			"content":     map[string]interface{}{"text/event-stream": map[string]interface{}{"schema": map[string]interface{}{"type": "string"}}},
+		}},
+	}
+}
+
+// webSocketOperation describes a scripted WebSocket endpoint.
+func webSocketOperation(info RouteInfo) map[string]interface{} {
+	return map[string]interface{}{
+		"summary":     "WebSocket endpoint scripted by " + info.File,
+		"description": "Connect with " + info.URL,
+		"operationId": operationID("connect", info.Route),
+		"tags":        []string{"websocket"},
+		"responses": map[string]interface{}{
+			"101": map[string]interface{}{"description": "Switching to the WebSocket protocol"},
+			"426": map[string]interface{}{"description": "The request was not a WebSocket upgrade"},
+		},
+	}
+}
+
+// withWriteOperations adds the POST, PUT and PATCH operations echoing a
+// validated body. The body schema is the shape of the file or its elements.
+func withWriteOperations(info RouteInfo, item map[string]interface{}) map[string]interface{} {
+	description := "The body is echoed back without changing " + info.File + "."
+	if _, err := os.Stat(schemaSidecar(info.File)); err == nil {
+		description += " It is validated by " + filepath.Base(schemaSidecar(info.File)) + "."
+	} else if strictShape {
+		description += " It must have the shape of the file."
+	}
+	body := map[string]interface{}{"type": "object"}
+	if elements, _, err := loadStreamElements(info.File); err == nil {
+		body = openAPISchema(inferShape(elements).Elem)
+	}
+	for _, method := range []string{"post", "put", "patch"} {
+		status := http.StatusOK
+		if method == "post" {
+			status = http.StatusCreated
+		}
+		op := map[string]interface{}{
+			"summary":     "Validate and echo a body for " + info.Route,
+			"description": description,
+			"operationId": operationID(method, info.Route),
+			"tags":        []string{"writes"},
+			"requestBody": map[string]interface{}{
+				"required": true,
+				"content":  map[string]interface{}{"application/json": map[string]interface{}{"schema": body}},
+			},
+			"responses": map[string]interface{}{
+				strconv.Itoa(status): jsonResponse("The accepted body", body, nil),
+				"400":                jsonResponse("Invalid JSON, query parameters or headers", validationErrorSchema, nil),
+				"422":                jsonResponse("The body does not match the schema", validationErrorSchema, nil),
+			},
+		}
+		addRuleResponses(op, info.File, method, status)
+		item[method] = op
+	}
+	return item
+}
+
+// addRuleResponses adds the statuses and headers returned by the rules of
+// file for method to the responses of op.
+func addRuleResponses(op map[string]interface{}, file, method string, status int) {
+	rules, err := loadMockRules(file)
+	if err != nil || rules == nil {
+		return
+	}
+	all := rules.Rules
+	if rules.Default != nil {
+		all = append(all, *rules.Default)
+	}
+	responses := op["responses"].(map[string]interface{})
+	for _, rule := range all {
+		if rule.Method != "" && !strings.EqualFold(rule.Method, method) {
+			continue
+		}
+		code := status
+		if rule.Status != 0 {
+			code = rule.Status
+		}
+		response, ok := responses[strconv.Itoa(code)].(map[string]interface{})
+		if !ok {
+			response = map[string]interface{}{"description": "Returned by rule " + rule.Name}
+			if rule.File != "" || rule.Body != nil {
+				response["content"] = map[string]interface{}{"application/json": map[string]interface{}{}}
+			}
+			responses[strconv.Itoa(code)] = response
+		}
+		headers, _ := response["headers"].(map[string]interface{})
+		if headers == nil {
+			headers = map[string]interface{}{}
+			response["headers"] = headers
+		}
+		headers[ruleHeader] = map[string]interface{}{
+			"description": "Name of the rule that answered the request",
+			"schema":      map[string]interface{}{"type": "string"},
+		}
+		for name := range rule.Headers {
+			headers[name] = map[string]interface{}{
+				"description": "Set by rule " + rule.Name,
+				"schema":      map[string]interface{}{"type": "string"},
+			}
+		}
+	}
+}
+
+var validationErrorSchema = map[string]interface{}{
+	"type": "object",
+	"properties": map[string]interface{}{
+		"error": map[string]interface{}{"type": "string"},
+		"errors": map[string]interface{}{"type": "array", "items": map[string]interface{}{
+			"type": "object",
+			"properties": map[string]interface{}{
+				"in":      map[string]interface{}{"type": "string", "enum": []string{"body", "query", "headers"}},
+				"pointer": map[string]interface{}{"type": "string"},
+				"message": map[string]interface{}{"type": "string"},
+			},
+		}},
+	},
+}
+
+// addPathParameters declares the parameters of route in every operation of item.
+func addPathParameters(route string, item interface{}) {
+	operations, ok := item.(map[string]interface{})
+	if !ok {
+		return
+	}
+	var parameters []map[string]interface{}
+	for _, name := range routeParameters(route) {
+		parameter := map[string]interface{}{
+			"name":     name,
+			"in":       "path",
+			"required": true,
+			"schema":   map[string]interface{}{"type": "string"},
+		}
+		if strings.HasSuffix(route, "{"+name+catchAllSuffix) {
+			parameter["description"] = "Rest of the path, may contain slashes"
+		}
+		parameters = append(parameters, parameter)
+	}
+	for _, op := range operations {
+		op := op.(map[string]interface{})
+		existing, _ := op["parameters"].([]map[string]interface{})
+		op["parameters"] = append(append([]map[string]interface{}{}, parameters...), existing...)
+	}
+}
+
+func jsonResponse(description string, schema map[string]interface{}, example interface{}) map[string]interface{} {
+	media := map[string]interface{}{"schema": schema}
+	if example != nil {
+		media["example"] = example
+	}
+	return map[string]interface{}{
+		"description": description,
+		"content":     map[string]interface{}{"application/json": media},
+	}
+}
+
+func queryParameter(name, typ, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"name":        name,
+		"in":          "query",
+		"description": description,
+		"schema":      map[string]interface{}{"type": typ},
+	}
+}
+
+// operationID turns a route into an operation id, e.g. getUsersList.
+func operationID(verb, route string) string {
+	return verb + graphqlTypeName(route)
+}
+
+// openAPISchema converts an inferred shape into an OpenAPI schema object.
+func openAPISchema(shape *jsonShape) map[string]interface{} {
+	switch shape.Kind {
+	case "object":
+		properties := make(map[string]interface{}, len(shape.Fields))
+		for _, key := range shape.Order {
+			properties[key] = openAPISchema(shape.Fields[key])
+		}
+		return map[string]interface{}{"type": "object", "properties": properties}
+	case "list":
+		return map[string]interface{}{"type": "array", "items": openAPISchema(shape.Elem)}
+	case "null":
+		return map[string]interface{}{"nullable": true}
+	}
+	switch shape.Scalar {
+	case "Int":
+		return map[string]interface{}{"type": "integer", "format": "int32"}
+	case "Int64":
+		return map[string]interface{}{"type": "integer", "format": "int64"}
+	case "Float":
+		schema := map[string]interface{}{"type": "number", "format": "double"}
+		if shape.Decimals > 0 {
+			schema["x-decimal-places"] = shape.Decimals
+		}
+		return schema
+	case "String":
+		return map[string]interface{}{"type": "string"}
+	case "Boolean":
+		return map[string]interface{}{"type": "boolean"}
+	}
+	return map[string]interface{}{} // any value
+}
+
+// exampleValue shortens the arrays of content so large files give small examples.
+func exampleValue(content interface{}) interface{} {
+	switch v := content.(type) {
+	case []interface{}:
+		n := len(v)
+		if n > maxExampleItems {
+			n = maxExampleItems
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			items[i] = exampleValue(v[i])
+		}
+		return items
+	case map[string]interface{}:
+		object := make(map[string]interface{}, len(v))
+		for k, item := range v {
+			object[k] = exampleValue(item)
+		}
+		return object
+	}
+	return content
+}
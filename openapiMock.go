@@ -0,0 +1,437 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/gorilla/mux"
+)
+
+const maxSchemaDepth = 8 // recursive schemas stop generating below this depth
+
+// mockSpec is the OpenAPI specification loaded with -openapi, nil without it.
+var mockSpec *openapi3.T
+
+// loadMockSpec reads and validates an OpenAPI 3 specification in JSON or YAML.
+func loadMockSpec(file string) (*openapi3.T, error) {
+	loader := openapi3.NewLoader()
+	loader.IsExternalRefsAllowed = true
+	spec, err := loader.LoadFromFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("error loading OpenAPI specification %s: %v", file, err)
+	}
+	if err := spec.Validate(loader.Context); err != nil {
+		return nil, fmt.Errorf("invalid OpenAPI specification %s: %v", file, err)
+	}
+	return spec, nil
+}
+
+// specBasePath returns the path of the first server URL, e.g. /v1 for
+// https://api.example.com/v1, which prefixes all paths of the spec.
+func specBasePath(spec *openapi3.T) string {
+	if len(spec.Servers) == 0 {
+		return ""
+	}
+	u, err := url.Parse(spec.Servers[0].URL)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimRight(u.Path, "/")
+}
+
+// registerSpecRoutes registers every path and method of the specification.
+// Path templates such as /users/{id} are gorilla/mux templates as well.
+func registerSpecRoutes(router *mux.Router, spec *openapi3.T) {
+	base := specBasePath(spec)
+	paths := spec.Paths.Map()
+	names := make([]string, 0, len(paths))
+	for path := range paths {
+		names = append(names, path)
+	}
+	// Literal segments first, so /users/me wins over /users/{id}
+	sort.Slice(names, func(i, j int) bool {
+		ci, cj := strings.Count(names[i], "{"), strings.Count(names[j], "{")
+		if ci != cj {
+			return ci < cj
+		}
+		return names[i] < names[j]
+	})
+
+	count := 0
+	for _, path := range names {
+		pathItem := paths[path]
+		for method, operation := range pathItem.Operations() {
+			route := &routers.Route{Spec: spec, Path: path, PathItem: pathItem, Method: method, Operation: operation}
+			router.HandleFunc(base+path, createSpecHandler(route)).Methods(method)
+			count++
+		}
+	}
+	log.Printf("Registered %d operations from the OpenAPI specification", count)
+	Lg.Infof("Registered %d operations from the OpenAPI specification", count)
+}
+
+// createSpecHandler validates requests of one operation and answers with an
+// example or fake data generated from the response schema. A served JSON file
+// with the route of the request (GET only) or named <operationId>.json overrides it.
+func createSpecHandler(route *routers.Route) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			if _, ok := routeFile(r.URL.Path); ok {
+				createFileHandler(r.URL.Path)(w, r)
+				return
+			}
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: mux.Vars(r),
+			Route:      route,
+			Options: &openapi3filter.Options{
+				MultiError:         true,
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+		if err := openapi3filter.ValidateRequest(context.Background(), input); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]interface{}{
+				"error":   "request does not match the OpenAPI specification",
+				"details": validationDetails(err),
+			})
+			return
+		}
+
+		status, response := selectSpecResponse(route.Operation, r)
+		if response == nil {
+			w.WriteHeader(status)
+			return
+		}
+		for name, header := range response.Headers {
+			if header.Value == nil || header.Value.Schema == nil {
+				continue
+			}
+			value := newSpecFaker().fromSchema(header.Value.Schema, name, 0)
+			w.Header().Set(name, fmt.Sprint(value))
+		}
+
+		if operationID := route.Operation.OperationID; operationID != "" {
+			if file, ok := routeFile("/" + operationID); ok {
+				if content, err := ioutil.ReadFile(file); err == nil {
+					w.Header().Set("Content-Type", "application/json")
+					w.WriteHeader(status)
+					w.Write(content)
+					return
+				}
+			}
+		}
+
+		mediaType, media := specMediaType(response.Content)
+		if media == nil {
+			w.WriteHeader(status)
+			return
+		}
+		body, ok := specExample(media, r)
+		if !ok {
+			body = newSpecFaker().fromSchema(media.Schema, "", 0)
+		}
+		w.Header().Set("Content-Type", mediaType)
+		w.WriteHeader(status)
+		if text, isText := body.(string); isText && !strings.Contains(mediaType, "json") {
+			w.Write([]byte(text))
+			return
+		}
+		json.NewEncoder(w).Encode(body)
+	}
+}
+
+// validationDetails lists short messages of a validation error, such as
+// `request body /name: minimum string length is 2`.
+func validationDetails(err error) []string {
+	return appendValidationDetails(nil, "", err)
+}
+
+func appendValidationDetails(details []string, prefix string, err error) []string {
+	switch e := err.(type) {
+	case openapi3.MultiError:
+		for _, item := range e {
+			details = appendValidationDetails(details, prefix, item)
+		}
+		return details
+	case *openapi3filter.RequestError:
+		switch {
+		case e.Parameter != nil:
+			prefix = fmt.Sprintf("%s parameter %q", e.Parameter.In, e.Parameter.Name)
+		case e.RequestBody != nil:
+			prefix = "request body"
+		}
+		if e.Err == nil {
+			return append(details, strings.TrimSpace(prefix+" "+e.Reason))
+		}
+		return appendValidationDetails(details, prefix, e.Err)
+	case *openapi3.SchemaError:
+		if pointer := e.JSONPointer(); len(pointer) > 0 {
+			prefix += " /" + strings.Join(pointer, "/")
+		}
+		return append(details, strings.TrimSpace(prefix)+": "+e.Reason)
+	}
+	if prefix != "" {
+		return append(details, prefix+": "+err.Error())
+	}
+	return append(details, err.Error())
+}
+
+// preferences parses a Prefer header such as "code=404, example=empty".
+func preferences(r *http.Request) map[string]string {
+	prefs := make(map[string]string)
+	for _, part := range strings.Split(r.Header.Get("Prefer"), ",") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(part), "="); ok {
+			prefs[strings.ToLower(k)] = strings.Trim(v, `"`)
+		}
+	}
+	return prefs
+}
+
+// selectSpecResponse picks the response requested by "Prefer: code=...", else
+// the first 2xx response, else default.
+func selectSpecResponse(operation *openapi3.Operation, r *http.Request) (int, *openapi3.Response) {
+	responses := operation.Responses.Map()
+	if code := preferences(r)["code"]; code != "" {
+		if ref, ok := responses[code]; ok && ref.Value != nil {
+			return specStatus(code), ref.Value
+		}
+		if status, err := strconv.Atoi(code); err == nil && status >= 100 && status <= 599 {
+			// Prefer: code=404 with a 4XX response in the spec
+			if ref, ok := responses[code[:1]+"XX"]; ok && ref.Value != nil {
+				return status, ref.Value
+			}
+		}
+	}
+	codes := make([]string, 0, len(responses))
+	for code := range responses {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		if strings.HasPrefix(code, "2") && responses[code].Value != nil {
+			return specStatus(code), responses[code].Value
+		}
+	}
+	if ref, ok := responses["default"]; ok && ref.Value != nil {
+		return http.StatusOK, ref.Value
+	}
+	return http.StatusNoContent, nil
+}
+
+// specStatus is the status of a response key of the spec: 200 for default,
+// N00 for a range such as 2XX.
+func specStatus(code string) int {
+	if status, err := strconv.Atoi(code); err == nil && status >= 100 && status <= 599 {
+		return status
+	}
+	if len(code) == 3 && code[0] >= '1' && code[0] <= '5' && strings.EqualFold(code[1:], "XX") {
+		return int(code[0]-'0') * 100
+	}
+	return http.StatusOK
+}
+
+// specMediaType prefers JSON content.
+func specMediaType(content openapi3.Content) (string, *openapi3.MediaType) {
+	if media := content.Get("application/json"); media != nil {
+		return "application/json", media
+	}
+	types := make([]string, 0, len(content))
+	for mediaType := range content {
+		types = append(types, mediaType)
+	}
+	sort.Strings(types)
+	if len(types) == 0 {
+		return "", nil
+	}
+	return types[0], content[types[0]]
+}
+
+// specExample returns the example of a media type. "Prefer: example=name"
+// chooses one of several named examples.
+func specExample(media *openapi3.MediaType, r *http.Request) (interface{}, bool) {
+	if media.Example != nil {
+		return media.Example, true
+	}
+	if len(media.Examples) > 0 {
+		if ref, ok := media.Examples[preferences(r)["example"]]; ok && ref.Value != nil {
+			return ref.Value.Value, true
+		}
+		names := make([]string, 0, len(media.Examples))
+		for name := range media.Examples {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if ref := media.Examples[names[0]]; ref.Value != nil {
+			return ref.Value.Value, true
+		}
+	}
+	if media.Schema != nil && media.Schema.Value != nil && media.Schema.Value.Example != nil {
+		return media.Schema.Value.Example, true
+	}
+	return nil, false
+}
+
+// specFaker generates values for OpenAPI schemas with the fake data engine.
+type specFaker struct {
+	gen *FakeGenerator
+}
+
+func newSpecFaker() *specFaker {
+	gen, err := newGeneratorFromFlags()
+	if err != nil {
+		gen = NewFakeGenerator(0)
+	}
+	return &specFaker{gen: gen}
+}
+
+// fromSchema generates a value for schema, key is the property name used to
+// choose a matching generator rule, e.g. email or city.
+func (f *specFaker) fromSchema(ref *openapi3.SchemaRef, key string, depth int) interface{} {
+	if ref == nil || ref.Value == nil || depth > maxSchemaDepth {
+		return nil
+	}
+	s := ref.Value
+	switch {
+	case s.Example != nil:
+		return s.Example
+	case len(s.Enum) > 0:
+		return s.Enum[f.gen.Faker.IntN(len(s.Enum))]
+	case len(s.AllOf) > 0:
+		merged := map[string]interface{}{}
+		for _, part := range s.AllOf {
+			if object, ok := f.fromSchema(part, key, depth+1).(map[string]interface{}); ok {
+				for k, v := range object {
+					merged[k] = v
+				}
+			}
+		}
+		return merged
+	case len(s.OneOf) > 0:
+		return f.fromSchema(s.OneOf[0], key, depth+1)
+	case len(s.AnyOf) > 0:
+		return f.fromSchema(s.AnyOf[0], key, depth+1)
+	}
+
+	switch {
+	case s.Type.Is("object") || (s.Type == nil && len(s.Properties) > 0):
+		object := make(map[string]interface{}, len(s.Properties))
+		names := make([]string, 0, len(s.Properties))
+		for name := range s.Properties {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			object[name] = f.fromSchema(s.Properties[name], name, depth+1)
+		}
+		return object
+	case s.Type.Is("array"):
+		n := int(s.MinItems)
+		max := n + 3
+		if s.MaxItems != nil && int(*s.MaxItems) < max {
+			max = int(*s.MaxItems)
+		}
+		if max > n {
+			n += f.gen.Faker.IntN(max - n + 1)
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			f.gen.identity = nil // every element describes another person
+			items[i] = f.fromSchema(s.Items, key, depth+1)
+		}
+		return items
+	case s.Type.Is("integer"):
+		min, max := schemaRange(s, 1, 1000)
+		if max-min > 1e9 {
+			max = min + 1e9
+		}
+		return int64(min) + int64(f.gen.Faker.IntN(int(max-min)+1))
+	case s.Type.Is("number"):
+		min, max := schemaRange(s, 1, 1000)
+		value := min + f.gen.Faker.Float64()*(max-min)
+		return float64(int64(value*100)) / 100
+	case s.Type.Is("boolean"):
+		return f.gen.Faker.Bool()
+	case s.Type.Is("string"):
+		return f.fakeString(s, key)
+	}
+	return nil
+}
+
+func schemaRange(s *openapi3.Schema, defaultMin, defaultMax float64) (float64, float64) {
+	min, max := defaultMin, defaultMax
+	if s.Min != nil {
+		min = *s.Min
+		if s.Max == nil && max < min {
+			max = min + 1000
+		}
+	}
+	if s.Max != nil {
+		max = *s.Max
+		if s.Min == nil && min > max {
+			min = max - 1000
+		}
+	}
+	if max < min {
+		max = min
+	}
+	return min, max
+}
+
+// fakeString generates a string by format, pattern or property name.
+func (f *specFaker) fakeString(s *openapi3.Schema, key string) interface{} {
+	g := f.gen
+	var value string
+	switch s.Format {
+	case "date-time":
+		value = g.Faker.Date().Format(time.RFC3339)
+	case "date":
+		value = g.Faker.Date().Format("2006-01-02")
+	case "email":
+		value = fmt.Sprint(fakeRules["email"](g))
+	case "uuid":
+		value = g.Faker.UUID()
+	case "uri", "url":
+		value = g.Faker.URL()
+	case "hostname":
+		value = g.Faker.DomainName()
+	case "ipv4":
+		value = g.Faker.IPv4Address()
+	case "ipv6":
+		value = g.Faker.IPv6Address()
+	case "password":
+		value = g.Faker.Password(true, true, true, true, false, 12)
+	default:
+		if s.Pattern != "" {
+			return g.Faker.Regex(s.Pattern)
+		}
+		if rule := g.RuleFor(key, "sample"); rule != "" {
+			if fn, ok := fakeRules[rule]; ok {
+				value = fmt.Sprint(fn(g))
+			}
+		}
+		if value == "" {
+			value = g.Faker.Word()
+		}
+	}
+	if s.MaxLength != nil && uint64(len(value)) > *s.MaxLength {
+		value = value[:*s.MaxLength]
+	}
+	for uint64(len(value)) < s.MinLength {
+		value += g.Faker.Letter()
+	}
+	return value
+}
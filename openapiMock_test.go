@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+)
+
+func TestSelectSpecResponse(t *testing.T) {
+	response := func(description string) *openapi3.Response {
+		return openapi3.NewResponse().WithDescription(description)
+	}
+	tests := []struct {
+		name        string
+		responses   []openapi3.NewResponsesOption
+		prefer      string
+		status      int
+		description string
+	}{
+		{"first 2xx", []openapi3.NewResponsesOption{openapi3.WithName("404", response("missing")), openapi3.WithName("201", response("created")), openapi3.WithName("200", response("ok"))}, "", 200, "ok"},
+		{"default only", []openapi3.NewResponsesOption{openapi3.WithName("default", response("default"))}, "", 200, "default"},
+		{"range", []openapi3.NewResponsesOption{openapi3.WithName("2XX", response("success")), openapi3.WithName("default", response("default"))}, "", 200, "success"},
+		{"no response", []openapi3.NewResponsesOption{openapi3.WithName("500", response("error"))}, "", 204, ""},
+		{"prefer code", []openapi3.NewResponsesOption{openapi3.WithName("200", response("ok")), openapi3.WithName("404", response("missing"))}, "code=404", 404, "missing"},
+		{"prefer range", []openapi3.NewResponsesOption{openapi3.WithName("200", response("ok")), openapi3.WithName("4XX", response("client error"))}, "code=409", 409, "client error"},
+		{"prefer default", []openapi3.NewResponsesOption{openapi3.WithName("200", response("ok")), openapi3.WithName("default", response("default"))}, "code=default", 200, "default"},
+		{"prefer unknown code", []openapi3.NewResponsesOption{openapi3.WithName("200", response("ok"))}, "code=503", 200, "ok"},
+	}
+	for _, tt := range tests {
+		operation := openapi3.NewOperation()
+		operation.Responses = openapi3.NewResponses(tt.responses...)
+		r := httptest.NewRequest(http.MethodGet, "/pets", nil)
+		if tt.prefer != "" {
+			r.Header.Set("Prefer", tt.prefer)
+		}
+		status, selected := selectSpecResponse(operation, r)
+		if status != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.name, status, tt.status)
+		}
+		description := ""
+		if selected != nil && selected.Description != nil {
+			description = *selected.Description
+		}
+		if description != tt.description {
+			t.Errorf("%s: response %q, want %q", tt.name, description, tt.description)
+		}
+	}
+}
+
+func TestSpecStatus(t *testing.T) {
+	for code, want := range map[string]int{"200": 200, "404": 404, "default": 200, "2XX": 200, "4xx": 400, "5XX": 500, "9XX": 200} {
+		if got := specStatus(code); got != want {
+			t.Errorf("specStatus(%q) = %d, want %d", code, got, want)
+		}
+	}
+}
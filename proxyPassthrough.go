@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const proxyHeader = "X-GoEasyJson-Proxy"
+
+// proxyHandler forwards requests without a JSON route to the -proxy upstream,
+// nil when no upstream is set.
+var proxyHandler http.Handler
+
+// newProxyHandler returns a reverse proxy to upstream which keeps the method,
+// headers and body of requests. Responses name the upstream URL in the
+// X-GoEasyJson-Proxy header, shown by the request log of the Web UI.
+func newProxyHandler(upstream string) (http.Handler, error) {
+	target, err := url.Parse(upstream)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return nil, fmt.Errorf("invalid -proxy %q, expected an http(s) URL such as https://staging.example.com", upstream)
+	}
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	director := proxy.Director
+	proxy.Director = func(r *http.Request) {
+		director(r)
+		r.Host = target.Host // virtual hosts of the upstream expect their own name
+		if recordMode {
+			r.Header.Del("Accept-Encoding") // recorded bodies are saved decompressed
+		}
+	}
+	proxy.FlushInterval = -1 // pass streamed responses through right away
+	proxy.ModifyResponse = func(resp *http.Response) error {
+		resp.Header.Set(proxyHeader, proxiedURL(resp.Request.URL))
+		if recordMode {
+			return recordResponse(resp)
+		}
+		return nil
+	}
+	proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+		Lg.Errorf("Proxy to %s failed for %s %s: %v", target.Redacted(), r.Method, r.URL.Path, err)
+		w.Header().Set(proxyHeader, proxiedURL(r.URL))
+		writeJSONError(w, http.StatusBadGateway, "upstream "+target.Redacted()+" failed: "+err.Error())
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &proxyStatusWriter{ResponseWriter: w, status: http.StatusOK}
+		proxy.ServeHTTP(rec, r)
+		message := fmt.Sprintf("Proxied %s %s to %s: %d in %s", r.Method, r.URL.RequestURI(),
+			strings.TrimSuffix(target.Redacted(), "/"), rec.status, time.Since(start).Round(time.Millisecond))
+		log.Print(message)
+		Lg.Info(message)
+	}), nil
+}
+
+// proxiedURL is the upstream URL for the X-GoEasyJson-Proxy header, with
+// secrets of the query such as access_token redacted like the request log.
+func proxiedURL(u *url.URL) string {
+	redacted := *u
+	redacted.User = nil
+	redacted.RawQuery = inspectedQuery(u.RawQuery)
+	return redacted.String()
+}
+
+// proxyStatusWriter keeps the status of a proxied response for the log.
+type proxyStatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *proxyStatusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *proxyStatusWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap gives the reverse proxy access to the hijacker of connection upgrades.
+func (w *proxyStatusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// methodNotAllowed forwards a request using a method the mocked route does
+// not serve to the upstream, or answers 405 without one.
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	if proxyHandler != nil {
+		proxyHandler.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProxyHandler(t *testing.T) {
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Upstream-Host", r.Host)
+		w.WriteHeader(http.StatusAccepted)
+		io.WriteString(w, `{"method":"`+r.Method+`","path":"`+r.URL.RequestURI()+`","body":`+string(body)+`}`)
+	}))
+	defer upstream.Close()
+
+	handler, err := newProxyHandler(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := httptest.NewRequest(http.MethodPatch, "/orders/7?expand=items&access_token=abc", strings.NewReader(`{"qty":2}`))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusAccepted {
+		t.Errorf("status %d, want %d", w.Code, http.StatusAccepted)
+	}
+	if want := `{"method":"PATCH","path":"/orders/7?expand=items&access_token=abc","body":{"qty":2}}`; w.Body.String() != want {
+		t.Errorf("body %s, want %s", w.Body, want)
+	}
+	if got := w.Header().Get("X-Upstream-Host"); got != strings.TrimPrefix(upstream.URL, "http://") {
+		t.Errorf("upstream saw host %q, want its own", got)
+	}
+	if got := w.Header().Get(proxyHeader); got != upstream.URL+"/orders/7?access_token=REDACTED&expand=items" {
+		t.Errorf("%s = %q", proxyHeader, got)
+	}
+}
+
+func TestProxyHandlerUpstreamDown(t *testing.T) {
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	upstream.Close()
+
+	handler, err := newProxyHandler(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/users", nil))
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("status %d, want %d", w.Code, http.StatusBadGateway)
+	}
+}
+
+func TestNewProxyHandlerInvalidUpstream(t *testing.T) {
+	for _, upstream := range []string{"", "staging.example.com", "ftp://example.com", "http://"} {
+		if _, err := newProxyHandler(upstream); err == nil {
+			t.Errorf("newProxyHandler(%q) accepted the upstream", upstream)
+		}
+	}
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// rateLimit throttles the clients of the routes like a real API does. The
+// global limit comes from the -rate-limit flags, a route overrides it with
+// the "rateLimit" object of its .rules.json file:
+//
+//	{"rateLimit": {"rate": "5/m", "burst": 2, "by": "key", "quota": 100}, "rules": [...]}
+type rateLimit struct {
+	Rate  string `json:"rate,omitempty"`  // tokens per period such as 10/s, 100/m or 1000/h, "off" disables the limit
+	Burst *int   `json:"burst,omitempty"` // size of the token bucket, the tokens of one period by default
+	By    string `json:"by,omitempty"`    // ip, key (API key or Authorization of the client) or route (all clients share)
+	Quota *int   `json:"quota,omitempty"` // requests per client and day, 0 for none
+}
+
+// tokenBucket holds the counters of one client of a limit.
+type tokenBucket struct {
+	Key        string    `json:"key"`
+	Route      string    `json:"route"` // * for the global limit
+	Client     string    `json:"client"`
+	Rate       string    `json:"rate,omitempty"`
+	Limit      int       `json:"limit,omitempty"`
+	Remaining  int       `json:"remaining"`
+	Quota      int       `json:"quota,omitempty"`
+	Used       int       `json:"used"` // requests accepted today
+	Rejected   int       `json:"rejected"`
+	QuotaReset time.Time `json:"quotaReset"`
+	LastSeen   time.Time `json:"lastSeen"`
+	tokens     float64
+	updated    time.Time
+}
+
+const (
+	bucketIdleTTL       = 10 * time.Minute // buckets unused for longer are forgotten once full again
+	bucketSweepInterval = time.Minute
+)
+
+var (
+	bucketsLock sync.Mutex
+	buckets     = map[string]*tokenBucket{}
+	lastSweep   time.Time
+)
+
+// globalRateLimit is the limit of the -rate-limit and -quota flags, nil
+// without them.
+func globalRateLimit() *rateLimit {
+	if rateLimitFlag == "" && quotaFlag == 0 {
+		return nil
+	}
+	limit := &rateLimit{Rate: rateLimitFlag, By: rateBy, Quota: &quotaFlag}
+	if rateBurst > 0 {
+		limit.Burst = &rateBurst
+	}
+	return limit
+}
+
+// routeRateLimit returns the limit of the route serving path with the route
+// it is counted for, * when the global limit applies to every route.
+func routeRateLimit(path string) (*rateLimit, string) {
+	limit := globalRateLimit()
+	route, file, ok := servingRoute(path)
+	if !ok {
+		route = path
+	}
+	scope := "*"
+	if ok {
+		if rules, err := loadMockRules(file); err == nil && rules != nil && rules.Limit != nil {
+			merged := rateLimit{By: rateBy}
+			if limit != nil {
+				merged = *limit
+			}
+			if rules.Limit.Rate != "" {
+				merged.Rate = rules.Limit.Rate
+				merged.Burst = rules.Limit.Burst // a burst of the global rate does not fit the route rate
+			} else if rules.Limit.Burst != nil {
+				merged.Burst = rules.Limit.Burst
+			}
+			if rules.Limit.By != "" {
+				merged.By = rules.Limit.By
+			}
+			if rules.Limit.Quota != nil {
+				merged.Quota = rules.Limit.Quota
+			}
+			limit, scope = &merged, route
+		}
+	}
+	if limit != nil && limit.By == "route" {
+		scope = route
+	}
+	return limit, scope
+}
+
+// parseRate reads 10/s, 100/m, 1000/h, 5000/d or 3/10s as a number of tokens
+// per period.
+func parseRate(rate string) (float64, time.Duration, error) {
+	count, per, found := strings.Cut(strings.TrimSpace(rate), "/")
+	n, err := strconv.ParseFloat(count, 64)
+	if !found || err != nil || n <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate %q, expected requests per period such as 10/s or 100/m", rate)
+	}
+	if per == "d" {
+		return n, 24 * time.Hour, nil
+	}
+	if per != "" && (per[0] < '0' || per[0] > '9') {
+		per = "1" + per
+	}
+	period, err := time.ParseDuration(per)
+	if err != nil || period <= 0 {
+		return 0, 0, fmt.Errorf("invalid rate %q, expected requests per period such as 10/s or 100/m", rate)
+	}
+	return n, period, nil
+}
+
+// validate checks the rate and the client kind of the limit.
+func (l *rateLimit) validate() error {
+	if l.Rate != "" && l.Rate != "off" {
+		if _, _, err := parseRate(l.Rate); err != nil {
+			return err
+		}
+	}
+	switch l.By {
+	case "", "ip", "key", "route":
+		return nil
+	}
+	return fmt.Errorf("invalid rate limit client %q, expected ip, key or route", l.By)
+}
+
+// rateLimitClient names the client of r the limit counts for.
+func rateLimitClient(r *http.Request, by string) string {
+	switch by {
+	case "route":
+		return "all"
+	case "key":
+		// Keys and tokens are secret, the counters and logs keep a short fingerprint
+		if key := r.Header.Get(apiKeyHeader()); key != "" {
+			return "key:" + fingerprint(key)
+		}
+		if key := r.URL.Query().Get("api_key"); key != "" {
+			return "key:" + fingerprint(key)
+		}
+		if authorization := r.Header.Get("Authorization"); authorization != "" {
+			return "auth:" + fingerprint(authorization)
+		}
+	}
+	return "ip:" + clientHost(r)
+}
+
+// fingerprint is the start of the SHA-256 of a secret.
+func fingerprint(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// nextMidnight is when the daily quotas start again.
+func nextMidnight(now time.Time) time.Time {
+	year, month, day := now.Date()
+	return time.Date(year, month, day+1, 0, 0, 0, 0, now.Location())
+}
+
+// take counts a request of the bucket. It returns 0 when the request is
+// accepted, else how long the client should wait.
+func (b *tokenBucket) take(limit *rateLimit, now time.Time) time.Duration {
+	b.LastSeen = now
+	if !now.Before(b.QuotaReset) {
+		b.Used = 0
+		b.QuotaReset = nextMidnight(now)
+	}
+	b.Quota = 0
+	if limit.Quota != nil {
+		b.Quota = *limit.Quota
+	}
+
+	var perSecond float64
+	b.Rate, b.Limit = "", 0
+	if n, period, err := parseRate(limit.Rate); err == nil {
+		perSecond = n / period.Seconds()
+		b.Rate, b.Limit = limit.Rate, int(math.Ceil(n))
+		if limit.Burst != nil && *limit.Burst > 0 {
+			b.Limit = *limit.Burst
+		}
+		if b.updated.IsZero() {
+			b.tokens = float64(b.Limit)
+		} else {
+			b.tokens = math.Min(float64(b.Limit), b.tokens+now.Sub(b.updated).Seconds()*perSecond)
+		}
+		b.updated = now
+	}
+
+	var wait time.Duration
+	switch {
+	case b.Quota > 0 && b.Used >= b.Quota:
+		wait = b.QuotaReset.Sub(now)
+	case b.Limit > 0 && b.tokens < 1:
+		wait = time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	default:
+		if b.Limit > 0 {
+			b.tokens--
+		}
+		b.Used++
+	}
+	if wait > 0 {
+		b.Rejected++
+	}
+	b.Remaining = int(math.Floor(b.tokens))
+	return wait
+}
+
+// idle reports whether the bucket can be forgotten: unused for bucketIdleTTL,
+// full again and without requests left to count against today's quota, so
+// a new bucket would behave the same.
+func (b *tokenBucket) idle(now time.Time) bool {
+	if now.Sub(b.LastSeen) < bucketIdleTTL {
+		return false
+	}
+	if b.Quota > 0 && b.Used > 0 && now.Before(b.QuotaReset) {
+		return false
+	}
+	if n, period, err := parseRate(b.Rate); err == nil {
+		return b.tokens+now.Sub(b.updated).Seconds()*n/period.Seconds() >= float64(b.Limit)
+	}
+	return true
+}
+
+// sweepBuckets forgets the idle buckets, at most once per
+// bucketSweepInterval. bucketsLock must be held.
+func sweepBuckets(now time.Time) {
+	if now.Sub(lastSweep) < bucketSweepInterval {
+		return
+	}
+	lastSweep = now
+	for key, bucket := range buckets {
+		if bucket.idle(now) {
+			delete(buckets, key)
+		}
+	}
+}
+
+// setHeaders adds the X-RateLimit-* and X-Quota-* headers of the bucket.
+// Reset headers are seconds from now.
+func (b *tokenBucket) setHeaders(h http.Header, limit *rateLimit, now time.Time) {
+	if b.Limit > 0 {
+		n, period, _ := parseRate(limit.Rate)
+		full := (float64(b.Limit) - b.tokens) / (n / period.Seconds())
+		h.Set("X-RateLimit-Limit", strconv.Itoa(b.Limit))
+		h.Set("X-RateLimit-Remaining", strconv.Itoa(b.Remaining))
+		h.Set("X-RateLimit-Reset", strconv.Itoa(int(math.Ceil(full))))
+		h.Set("X-RateLimit-Policy", fmt.Sprintf("%d;w=%d", b.Limit, int(math.Ceil(float64(b.Limit)/n*period.Seconds()))))
+	}
+	if b.Quota > 0 {
+		h.Set("X-Quota-Limit", strconv.Itoa(b.Quota))
+		h.Set("X-Quota-Remaining", strconv.Itoa(max(b.Quota-b.Used, 0)))
+		h.Set("X-Quota-Reset", strconv.Itoa(int(math.Ceil(b.QuotaReset.Sub(now).Seconds()))))
+	}
+}
+
+// limitRate answers 429 with Retry-After to clients over the rate limit or
+// the daily quota of a route. Built-in pages and endpoints are not limited.
+func limitRate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inspectorSkipped(r.URL.Path) || builtinPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		limit, scope := routeRateLimit(r.URL.Path)
+		if limit == nil || (limit.Rate == "" || limit.Rate == "off") && (limit.Quota == nil || *limit.Quota <= 0) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := rateLimitClient(r, limit.By)
+		key := scope + " " + client
+		now := time.Now()
+
+		bucketsLock.Lock()
+		sweepBuckets(now)
+		bucket, ok := buckets[key]
+		if !ok {
+			bucket = &tokenBucket{Key: key, Route: scope, Client: client}
+			buckets[key] = bucket
+		}
+		wait := bucket.take(limit, now)
+		bucket.setHeaders(w.Header(), limit, now)
+		quota := bucket.Quota // the bucket changes once unlocked
+		quotaExceeded := quota > 0 && bucket.Used >= quota && wait > 0
+		bucketsLock.Unlock()
+
+		if wait > 0 {
+			message := "rate limit of " + limit.Rate + " exceeded"
+			if quotaExceeded {
+				message = "daily quota of " + strconv.Itoa(quota) + " requests exceeded"
+			}
+			log.Printf("Throttled %s %s from %s: %s", r.Method, r.URL.Path, client, message)
+			Lg.Warnf("Throttled %s %s from %s: %s", r.Method, r.URL.Path, client, message)
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeJSON(w, http.StatusTooManyRequests, map[string]string{"error": "too_many_requests", "error_description": message})
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleListRateLimits returns the counters of every client, ?route= keeps
+// the ones of a route.
+func handleListRateLimits(w http.ResponseWriter, r *http.Request) {
+	route := r.URL.Query().Get("route")
+	now := time.Now()
+	bucketsLock.Lock()
+	list := make([]tokenBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		if route != "" && bucket.Route != route {
+			continue
+		}
+		current := *bucket
+		if n, period, err := parseRate(current.Rate); err == nil {
+			// Show the tokens refilled since the last request
+			current.Remaining = int(math.Min(float64(current.Limit), current.tokens+now.Sub(current.updated).Seconds()*n/period.Seconds()))
+		}
+		if !now.Before(current.QuotaReset) {
+			current.Used = 0
+		}
+		list = append(list, current)
+	}
+	bucketsLock.Unlock()
+	sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"limits": list, "global": globalRateLimit()})
+}
+
+// handleResetRateLimits forgets the counters of ?key=, ?route=, ?client= or
+// of every client, which get full buckets and quotas again.
+func handleResetRateLimits(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	key, route, client := query.Get("key"), query.Get("route"), query.Get("client")
+	bucketsLock.Lock()
+	removed := 0
+	for k, bucket := range buckets {
+		if (key == "" || k == key) && (route == "" || bucket.Route == route) && (client == "" || bucket.Client == client) {
+			delete(buckets, k)
+			removed++
+		}
+	}
+	bucketsLock.Unlock()
+	log.Printf("Reset %d rate limit counters", removed)
+	Lg.Infof("Reset %d rate limit counters", removed)
+	writeJSON(w, http.StatusOK, map[string]int{"reset": removed})
+}
+
+func registerRateLimitAdmin(admin *mux.Router) {
+	admin.HandleFunc("/ratelimits", handleListRateLimits).Methods("GET")
+	admin.HandleFunc("/ratelimits", handleResetRateLimits).Methods("DELETE")
+}
@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		rate   string
+		n      float64
+		period time.Duration
+		ok     bool
+	}{
+		{"10/s", 10, time.Second, true},
+		{"100/m", 100, time.Minute, true},
+		{"1000/h", 1000, time.Hour, true},
+		{"5000/d", 5000, 24 * time.Hour, true},
+		{"3/10s", 3, 10 * time.Second, true},
+		{" 2.5/s ", 2.5, time.Second, true},
+		{"", 0, 0, false},
+		{"10", 0, 0, false},
+		{"0/s", 0, 0, false},
+		{"-1/s", 0, 0, false},
+		{"x/s", 0, 0, false},
+		{"5/x", 0, 0, false},
+		{"5/0s", 0, 0, false},
+	}
+	for _, tt := range tests {
+		n, period, err := parseRate(tt.rate)
+		if (err == nil) != tt.ok {
+			t.Errorf("parseRate(%q) error = %v, want ok %v", tt.rate, err, tt.ok)
+			continue
+		}
+		if n != tt.n || period != tt.period {
+			t.Errorf("parseRate(%q) = %v, %v, want %v, %v", tt.rate, n, period, tt.n, tt.period)
+		}
+	}
+}
+
+func TestRateLimitValidate(t *testing.T) {
+	tests := []struct {
+		limit rateLimit
+		ok    bool
+	}{
+		{rateLimit{Rate: "10/s"}, true},
+		{rateLimit{Rate: "off"}, true},
+		{rateLimit{By: "key"}, true},
+		{rateLimit{Rate: "10/x"}, false},
+		{rateLimit{Rate: "10/s", By: "user"}, false},
+	}
+	for _, tt := range tests {
+		if err := tt.limit.validate(); (err == nil) != tt.ok {
+			t.Errorf("%+v.validate() = %v, want ok %v", tt.limit, err, tt.ok)
+		}
+	}
+}
+
+func TestTokenBucketTake(t *testing.T) {
+	start := time.Date(2026, 1, 2, 12, 0, 0, 0, time.Local)
+	burst, quota := 1, 2
+	tests := []struct {
+		name  string
+		limit rateLimit
+		at    []time.Duration // request times after start
+		waits []time.Duration // 0 when accepted
+	}{
+		{
+			name:  "bucket of one period",
+			limit: rateLimit{Rate: "2/s"},
+			at:    []time.Duration{0, 0, 0, time.Second},
+			waits: []time.Duration{0, 0, 500 * time.Millisecond, 0},
+		},
+		{
+			name:  "burst",
+			limit: rateLimit{Rate: "2/s", Burst: &burst},
+			at:    []time.Duration{0, 0, 500 * time.Millisecond},
+			waits: []time.Duration{0, 500 * time.Millisecond, 0},
+		},
+		{
+			name:  "daily quota",
+			limit: rateLimit{Quota: &quota},
+			at:    []time.Duration{0, time.Hour, 2 * time.Hour, 12 * time.Hour},
+			waits: []time.Duration{0, 0, 10 * time.Hour, 0},
+		},
+	}
+	for _, tt := range tests {
+		bucket := &tokenBucket{}
+		for i, at := range tt.at {
+			if wait := bucket.take(&tt.limit, start.Add(at)); wait != tt.waits[i] {
+				t.Errorf("%s: request %d waits %v, want %v", tt.name, i+1, wait, tt.waits[i])
+			}
+		}
+	}
+}
+
+func TestSweepBuckets(t *testing.T) {
+	saved := buckets
+	t.Cleanup(func() { buckets, lastSweep = saved, time.Time{} })
+
+	now := time.Date(2026, 1, 2, 12, 0, 0, 0, time.Local)
+	quota := 5
+	buckets = map[string]*tokenBucket{}
+	for key, limit := range map[string]rateLimit{"idle": {Rate: "1/s"}, "recent": {Rate: "1/s"}, "quota": {Quota: &quota}} {
+		bucket := &tokenBucket{Key: key}
+		at := now.Add(-time.Hour)
+		if key == "recent" {
+			at = now.Add(-time.Minute)
+		}
+		bucket.take(&limit, at)
+		buckets[key] = bucket
+	}
+	lastSweep = time.Time{}
+	sweepBuckets(now)
+	if _, ok := buckets["idle"]; ok {
+		t.Error("idle bucket was kept")
+	}
+	if _, ok := buckets["recent"]; !ok {
+		t.Error("recently used bucket was removed")
+	}
+	if _, ok := buckets["quota"]; !ok {
+		t.Error("bucket counting today's quota was removed")
+	}
+}
+
+func TestRateLimitClient(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/users?api_key=query-secret", nil)
+	r.RemoteAddr = "192.0.2.7:5000"
+	if got := rateLimitClient(r, "ip"); got != "ip:192.0.2.7" {
+		t.Errorf("by ip: %q", got)
+	}
+	if got := rateLimitClient(r, "route"); got != "all" {
+		t.Errorf("by route: %q", got)
+	}
+	fromQuery := rateLimitClient(r, "key")
+	r.Header.Set(apiKeyHeader(), "header-secret")
+	fromHeader := rateLimitClient(r, "key")
+	for _, client := range []string{fromQuery, fromHeader} {
+		if !strings.HasPrefix(client, "key:") || len(client) != len("key:")+12 || strings.Contains(client, "secret") {
+			t.Errorf("by key: %q, want a fingerprint of the key", client)
+		}
+	}
+	if fromQuery == fromHeader {
+		t.Error("two keys share a client")
+	}
+	if again := rateLimitClient(r, "key"); again != fromHeader {
+		t.Errorf("the same key gives %q and %q", fromHeader, again)
+	}
+}
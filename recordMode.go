@@ -0,0 +1,317 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	recordingsDir = ".recordings" // bodies of recorded variants, hidden folders are not served
+	redactedValue = "REDACTED"
+)
+
+// Response headers that describe the upstream connection rather than the mock.
+var unrecordedHeaders = map[string]bool{
+	"Connection": true, "Keep-Alive": true, "Transfer-Encoding": true, "Content-Length": true,
+	"Content-Encoding": true, "Date": true, "Proxy-Connection": true, "Upgrade": true,
+	"Trailer": true, http.CanonicalHeaderKey(proxyHeader): true,
+}
+
+var (
+	recordLock      sync.Mutex
+	unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9._=-]+`)
+)
+
+type recordKey struct{}
+
+// recordedRequest is what the recorder needs of the client request, the
+// reverse proxy only hands over the rewritten upstream request.
+type recordedRequest struct {
+	Method string
+	Path   string
+	Query  map[string][]string
+	Header http.Header
+}
+
+// recordRequests sends every request except those of the Web UI and the
+// built-in endpoints to the upstream in -record mode, so mocked routes are
+// recorded again instead of answering from their files.
+func recordRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inspectorSkipped(r.URL.Path) || builtinPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		original := &recordedRequest{Method: r.Method, Path: r.URL.Path, Query: r.URL.Query(), Header: r.Header.Clone()}
+		proxyHandler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), recordKey{}, original)))
+	})
+}
+
+// builtinPath reports whether path is served by GoEasyJson itself.
+func builtinPath(p string) bool {
+	return p == "/health" || p == graphqlPath || p == openAPIPath || p == apiDocsPath
+}
+
+// recordedResponse is a response saved by -record or an import.
+type recordedResponse struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// recording is a response ready to be written: the body goes to the route
+// file or a file below .recordings, the method, keyed query parameters and
+// headers, status and headers become a rule in the .rules.json file of the
+// route, so it is replayed without -record.
+type recording struct {
+	Base    string // route file without .json, e.g. users/42
+	Rule    mockRule
+	Variant string // name of the body file below .recordings
+	Body    []byte
+}
+
+// recordingKeys are the query parameters and headers telling responses apart.
+type recordingKeys struct {
+	Query      []string
+	Headers    []string
+	AllQuery   bool // every query parameter of the request is a key
+	PathParams bool // [id] segments are path parameters, not literal names
+}
+
+// recordResponse saves a proxied response of -record mode.
+func recordResponse(resp *http.Response) error {
+	original, ok := resp.Request.Context().Value(recordKey{}).(*recordedRequest)
+	if !ok || resp.StatusCode == http.StatusSwitchingProtocols ||
+		strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+		return nil // connection upgrades and event streams are passed through only
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	keys := recordingKeys{Query: splitList(recordQuery), Headers: splitList(recordHeaders)}
+	rec, err := newRecording(original, &recordedResponse{Status: resp.StatusCode, Header: resp.Header, Body: body}, keys)
+	if err == nil {
+		err = rec.save()
+	}
+	if err != nil {
+		Lg.Warnf("Not recorded %s %s: %v", original.Method, original.Path, err)
+		log.Printf("Not recorded %s %s: %v", original.Method, original.Path, err)
+	}
+	return nil
+}
+
+func newRecording(req *recordedRequest, resp *recordedResponse, keys recordingKeys) (*recording, error) {
+	body := resp.Body
+	if len(bytes.TrimSpace(body)) > 0 && !json.Valid(body) {
+		return nil, fmt.Errorf("the %s response is not JSON", resp.Header.Get("Content-Type"))
+	}
+	base, err := recordingBase(req.Path, keys.PathParams)
+	if err != nil {
+		return nil, err
+	}
+
+	rule := mockRule{Method: req.Method, Status: resp.Status, Headers: recordedHeaders(resp.Header)}
+	variant := []string{strings.ToLower(req.Method)}
+	nameParts := []string{"recorded", req.Method}
+	queryKeys := keys.Query
+	if keys.AllQuery {
+		queryKeys = nil
+		for name := range req.Query {
+			queryKeys = append(queryKeys, name)
+		}
+		sort.Strings(queryKeys)
+	}
+	for _, name := range queryKeys {
+		if values, ok := req.Query[name]; ok && len(values) > 0 {
+			value := values[0]
+			if isRedacted(name) {
+				value = redactedValue
+			}
+			if rule.Match.Query == nil {
+				rule.Match.Query = map[string]interface{}{}
+			}
+			rule.Match.Query[name] = matchValue(value)
+			variant = append(variant, name+"="+value)
+			nameParts = append(nameParts, name+"="+value)
+		}
+	}
+	for _, name := range keys.Headers {
+		if value := req.Header.Get(name); value != "" {
+			if isRedacted(name) {
+				value = redactedValue
+			}
+			if rule.Match.Headers == nil {
+				rule.Match.Headers = map[string]interface{}{}
+			}
+			rule.Match.Headers[name] = matchValue(value)
+			variant = append(variant, strings.ToLower(name)+"="+value)
+			nameParts = append(nameParts, name+"="+value)
+		}
+	}
+	rule.Name = strings.Join(nameParts, " ")
+	rule.Priority = len(rule.Match.Query) + len(rule.Match.Headers) // the most specific variant wins
+
+	if len(bytes.TrimSpace(body)) == 0 {
+		body = nil
+	} else {
+		var indented bytes.Buffer
+		if json.Indent(&indented, body, "", "  ") == nil {
+			body = indented.Bytes()
+		}
+	}
+	return &recording{Base: base, Rule: rule, Variant: strings.Join(variant, "."), Body: body}, nil
+}
+
+// plainGet reports whether the recording is a GET without keys, saved as the
+// route file itself.
+func (rec *recording) plainGet() bool {
+	return rec.Rule.Method == http.MethodGet && rec.Rule.Priority == 0 && rec.Body != nil
+}
+
+// save writes the body and the rule of the recording.
+func (rec *recording) save() error {
+	recordLock.Lock()
+	defer recordLock.Unlock()
+
+	rule := rec.Rule
+	routeFile := rec.Base + ".json"
+	rulesFile := rec.Base + rulesSuffix
+	if err := os.MkdirAll(filepath.Dir(routeFile), 0755); err != nil {
+		return err
+	}
+	_, statErr := os.Stat(routeFile)
+	plainGet := rec.plainGet()
+	if plainGet || (os.IsNotExist(statErr) && rec.Body != nil) {
+		// The route file makes the route exist and answers plain GET requests
+		if err := writeFileAtomic(routeFile, rec.Body, 0644); err != nil {
+			return err
+		}
+	}
+	if plainGet {
+		rule.File = filepath.Base(routeFile)
+	} else {
+		variantFile := filepath.Join(recordingsDir, rec.Base, unsafeNameChars.ReplaceAllString(rec.Variant, "_")+".json")
+		if err := os.MkdirAll(filepath.Dir(variantFile), 0755); err != nil {
+			return err
+		}
+		if err := writeFileAtomic(variantFile, rec.Body, 0644); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(filepath.Dir(rulesFile), variantFile)
+		if err != nil {
+			return err
+		}
+		rule.File = filepath.ToSlash(rel)
+	}
+
+	if err := saveRecordedRule(rulesFile, rule); err != nil {
+		return err
+	}
+	log.Printf("Recorded %s as rule %q of %s", rec.Base, rule.Name, rulesFile)
+	Lg.Infof("Recorded %s as rule %q of %s", rec.Base, rule.Name, rulesFile)
+	return nil
+}
+
+// recordingBase turns a request path into the file name it is recorded
+// under, /users/42 into users/42, without the .json extension.
+func recordingBase(requestPath string, pathParams bool) (string, error) {
+	clean := strings.Trim(path.Clean("/"+requestPath), "/")
+	if clean == "" {
+		return "", fmt.Errorf("the root path cannot be recorded")
+	}
+	for _, segment := range strings.Split(clean, "/") {
+		if pathParams && strings.HasPrefix(segment, "[") && strings.HasSuffix(segment, "]") {
+			continue
+		}
+		if strings.HasPrefix(segment, "_") || strings.HasPrefix(segment, "[") || strings.HasPrefix(segment, ".") {
+			return "", fmt.Errorf("segment %q would be read as a path parameter or hidden folder", segment)
+		}
+	}
+	return filepath.FromSlash(clean), nil
+}
+
+// saveRecordedRule adds rule to rulesFile, replacing a rule of the same name.
+// Rules written by hand are kept.
+func saveRecordedRule(rulesFile string, rule mockRule) error {
+	rules := &mockRules{}
+	if data, err := ioutil.ReadFile(rulesFile); err == nil {
+		if err := json.Unmarshal(data, rules); err != nil {
+			return fmt.Errorf("invalid rules file %s: %v", rulesFile, err)
+		}
+	}
+	replaced := false
+	for i := range rules.Rules {
+		if rules.Rules[i].Name == rule.Name {
+			rules.Rules[i] = rule
+			replaced = true
+		}
+	}
+	if !replaced {
+		rules.Rules = append(rules.Rules, rule)
+	}
+	sort.SliceStable(rules.Rules, func(i, j int) bool { return rules.Rules[i].Priority > rules.Rules[j].Priority })
+	data, err := json.MarshalIndent(rules, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(rulesFile, data, 0644)
+}
+
+// recordedHeaders keeps the response headers worth replaying, secrets are redacted.
+func recordedHeaders(header http.Header) map[string]string {
+	headers := make(map[string]string)
+	for name, values := range header {
+		if unrecordedHeaders[name] {
+			continue
+		}
+		if isRedacted(name) {
+			headers[name] = redactedValue
+			continue
+		}
+		headers[name] = strings.Join(values, ", ")
+	}
+	return headers
+}
+
+// matchValue is the rule matcher of a recorded value, redacted ones match any value.
+func matchValue(value string) interface{} {
+	if value == redactedValue {
+		return "*"
+	}
+	return value
+}
+
+func isRedacted(name string) bool {
+	for _, secret := range splitList(redactHeaders) {
+		if strings.EqualFold(secret, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitList splits a comma separated flag value.
+func splitList(list string) []string {
+	var items []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestRecordAndReplay records the responses of an upstream with -record,
+// then replays them from the written files without it.
+func TestRecordAndReplay(t *testing.T) {
+	t.Chdir(t.TempDir())
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Set-Cookie", "session=secret")
+			io.WriteString(w, `{"id":42,"name":"Ada"}`)
+		case http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	defer upstream.Close()
+
+	savedRecord, savedProxy, savedFiles := recordMode, proxyHandler, routeFiles
+	t.Cleanup(func() {
+		recordMode, proxyHandler = savedRecord, savedProxy
+		routesLock.Lock()
+		routeFiles = savedFiles
+		routesLock.Unlock()
+	})
+	recordMode = true
+	handler, err := newProxyHandler(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxyHandler = handler
+	recorder := recordRequests(http.NotFoundHandler())
+	for _, method := range []string{http.MethodGet, http.MethodDelete} {
+		w := httptest.NewRecorder()
+		recorder.ServeHTTP(w, httptest.NewRequest(method, "/users/42", nil))
+		if w.Code >= 300 {
+			t.Fatalf("%s while recording: status %d", method, w.Code)
+		}
+	}
+	if data, err := os.ReadFile("users/42.json"); err != nil || len(data) == 0 {
+		t.Fatalf("route file not recorded: %v", err)
+	}
+	rules, err := loadMockRules("users/42.json")
+	if err != nil || rules == nil || len(rules.Rules) != 2 {
+		t.Fatalf("recorded rules %+v, %v, want a GET and a DELETE rule", rules, err)
+	}
+	for _, rule := range rules.Rules {
+		if cookie := rule.Headers["Set-Cookie"]; cookie != "" && cookie != redactedValue {
+			t.Errorf("rule %s replays the cookie %q", rule.Name, cookie)
+		}
+	}
+
+	recordMode, proxyHandler = false, nil
+	routesLock.Lock()
+	routeFiles = map[string]string{"/users/42": "users/42.json"}
+	routesLock.Unlock()
+	tests := []struct {
+		method  string
+		handler http.HandlerFunc
+		status  int
+		body    string
+	}{
+		{http.MethodGet, createFileHandler("/users/42"), http.StatusOK, `"name": "Ada"`},
+		{http.MethodDelete, createRuleHandler("/users/42"), http.StatusNoContent, ""},
+		{http.MethodPut, createRuleHandler("/users/42"), http.StatusMethodNotAllowed, ""},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		tt.handler(w, httptest.NewRequest(tt.method, "/users/42", nil))
+		if w.Code != tt.status {
+			t.Errorf("replayed %s: status %d, want %d", tt.method, w.Code, tt.status)
+		}
+		if tt.body != "" && !strings.Contains(w.Body.String(), tt.body) {
+			t.Errorf("replayed %s: body %s, want %s", tt.method, w.Body, tt.body)
+		}
+	}
+}
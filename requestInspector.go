@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	maxInspectedBody  = 64 << 10 // request body bytes kept for the Web UI
+	inspectorHistory  = 200      // requests kept for Web UI clients that connect later
+	inspectorQueueLen = 256
+)
+
+// RequestRecord describes one handled request as shown in the Web UI request log.
+type RequestRecord struct {
+	ID              uint64              `json:"id"`
+	Time            time.Time           `json:"time"`
+	Method          string              `json:"method"`
+	Path            string              `json:"path"`
+	Query           string              `json:"query"`
+	RemoteAddr      string              `json:"remoteAddr"`
+	Headers         map[string][]string `json:"headers"`
+	Body            string              `json:"body"`
+	BodyTruncated   bool                `json:"bodyTruncated,omitempty"`
+	Status          int                 `json:"status"`
+	ResponseHeaders map[string][]string `json:"responseHeaders"`
+	ResponseSize    int64               `json:"responseSize"`
+	LatencyMs       float64             `json:"latencyMs"`
+	Upstream        string              `json:"upstream,omitempty"` // URL the request was proxied to
+}
+
+var (
+	requestSeq     uint64
+	inspectorQueue = make(chan RequestRecord, inspectorQueueLen)
+	inspectorLock  sync.Mutex
+	inspectorLog   []RequestRecord
+)
+
+// inspectorSkipped reports whether path belongs to the Web UI itself.
+func inspectorSkipped(path string) bool {
+	return path == "/" || path == "/ws" || path == "/favicon.ico" ||
+		strings.HasPrefix(path, "/static/") || strings.HasPrefix(path, adminPrefix+"/")
+}
+
+// inspectedHeaders copies h with the -redact headers and the API key hidden:
+// every Web UI client reads the request log.
+func inspectedHeaders(h http.Header) http.Header {
+	h = h.Clone()
+	for name, values := range h {
+		if isRedacted(name) || strings.EqualFold(name, apiKeyHeader()) {
+			h[name] = make([]string, len(values))
+			for i := range values {
+				h[name][i] = redactedValue
+			}
+		}
+	}
+	return h
+}
+
+// inspectedQuery hides the -redact parameters, access_token and api_key.
+func inspectedQuery(rawQuery string) string {
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return rawQuery
+	}
+	changed := false
+	for name := range query {
+		if isRedacted(name) || name == "access_token" || name == "api_key" {
+			query.Set(name, redactedValue)
+			changed = true
+		}
+	}
+	if !changed {
+		return rawQuery
+	}
+	return query.Encode()
+}
+
+// inspectRequests records every handled request and publishes it to the Web UI.
+func inspectRequests(next http.Handler) http.Handler {
+	go publishRequests()
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if inspectorSkipped(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		record := RequestRecord{
+			ID:         atomic.AddUint64(&requestSeq, 1),
+			Time:       start,
+			Method:     r.Method,
+			Path:       r.URL.Path,
+			Query:      inspectedQuery(r.URL.RawQuery),
+			RemoteAddr: r.RemoteAddr,
+			Headers:    inspectedHeaders(r.Header),
+		}
+		if isAuthEndpoint(r.URL.Path) && r.Body != nil && r.Body != http.NoBody {
+			record.Body = redactedValue // passwords and client secrets
+		} else if r.Body != nil && r.Body != http.NoBody {
+			// Keep the beginning of the body and hand the full stream to the handler
+			body, _ := ioutil.ReadAll(io.LimitReader(r.Body, maxInspectedBody+1))
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+			if len(body) > maxInspectedBody {
+				body = body[:maxInspectedBody]
+				record.BodyTruncated = true
+			}
+			record.Body = string(body)
+		}
+
+		rec := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		record.Status = rec.status
+		record.ResponseHeaders = inspectedHeaders(rec.Header()) // Set-Cookie and tokens of mocked logins
+		record.ResponseSize = rec.size
+		record.LatencyMs = float64(time.Since(start).Microseconds()) / 1000
+		if upstream, err := url.Parse(rec.Header().Get(proxyHeader)); err == nil {
+			record.Upstream = proxiedURL(upstream)
+		}
+		select {
+		case inspectorQueue <- record:
+		default:
+			// The Web UI is not keeping up, drop the record instead of slowing down the mock
+		}
+	})
+}
+
+// publishRequests keeps the recent history and broadcasts records to /ws clients.
+func publishRequests() {
+	for record := range inspectorQueue {
+		inspectorLock.Lock()
+		inspectorLog = append(inspectorLog, record)
+		if len(inspectorLog) > inspectorHistory {
+			inspectorLog = inspectorLog[len(inspectorLog)-inspectorHistory:]
+		}
+		inspectorLock.Unlock()
+
+		publishEvent(EventRequestServed, record)
+	}
+}
+
+func registerInspectorAdmin(admin *mux.Router) {
+	admin.HandleFunc("/requests", func(w http.ResponseWriter, r *http.Request) {
+		inspectorLock.Lock()
+		history := append([]RequestRecord(nil), inspectorLog...)
+		inspectorLock.Unlock()
+		writeJSON(w, http.StatusOK, map[string]interface{}{"requests": history})
+	}).Methods("GET")
+	admin.HandleFunc("/requests", func(w http.ResponseWriter, r *http.Request) {
+		inspectorLock.Lock()
+		inspectorLog = nil
+		inspectorLock.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("DELETE")
+}
+
+// readCloser reads from a replacement reader and closes the original body.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// responseRecorder captures the status and size of a response. It keeps
+// supporting streaming and connection upgrades of the wrapped writer.
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int64
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(b)
+	rec.size += int64(n)
+	return n, err
+}
+
+func (rec *responseRecorder) Flush() {
+	if f, ok := rec.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (rec *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := rec.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer does not support hijacking")
+	}
+	rec.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	rulesSuffix = ".rules.json"
+	ruleHeader  = "X-GoEasyJson-Rule"
+)
+
+// mockRules lists the conditional responses of a route, read from the
+// users.rules.json file next to users.json.
+type mockRules struct {
+	Rules   []mockRule  `json:"rules"`
+	Default *mockRule   `json:"default,omitempty"`   // used when no rule matches, else the route file is served
+	CORS    *corsPolicy `json:"cors,omitempty"`      // CORS policy of the route, see corsPolicy
+	Limit   *rateLimit  `json:"rateLimit,omitempty"` // rate limit and quota of the route, see rateLimit
+}
+
+// mockRule returns File or Body when all its matchers match the request.
+// Matcher values are strings compared exactly, "*" for any present value or
+// {"regex": "..."}. Body matchers take a path such as $.user.role and may
+// compare numbers and booleans too.
+type mockRule struct {
+	Name     string            `json:"name,omitempty"`
+	Priority int               `json:"priority,omitempty"` // higher priorities are tried first
+	Method   string            `json:"method,omitempty"`   // empty matches every method
+	Match    ruleMatch         `json:"match"`
+	File     string            `json:"file,omitempty"` // relative to the rules file
+	Body     interface{}       `json:"body,omitempty"` // inline response with {{query.x}}, {{body.x}}... placeholders
+	Status   int               `json:"status,omitempty"`
+	Headers  map[string]string `json:"headers,omitempty"`
+	Delay    string            `json:"delay,omitempty"`
+	delay    time.Duration
+	matchers []valueMatcher
+}
+
+type ruleMatch struct {
+	Query   map[string]interface{} `json:"query,omitempty"`
+	Headers map[string]interface{} `json:"headers,omitempty"`
+	Cookies map[string]interface{} `json:"cookies,omitempty"`
+	Path    map[string]interface{} `json:"path,omitempty"`   // path parameters of the route
+	Body    map[string]interface{} `json:"body,omitempty"`   // JSON paths of the request body
+	Claims  map[string]interface{} `json:"claims,omitempty"` // claims of the caller authenticated with -auth
+}
+
+// valueMatcher checks one value of the request.
+type valueMatcher struct {
+	source string // query, headers, cookies, path, body or claims
+	key    string
+	any    bool
+	regex  *regexp.Regexp
+	value  interface{}
+}
+
+// ruleRequest is the part of a request the rules look at.
+type ruleRequest struct {
+	r      *http.Request
+	body   interface{}
+	values map[string]interface{} // template values of inline bodies
+}
+
+// isRulesFile reports whether file holds the rules of a route, it is not served itself.
+func isRulesFile(file string) bool {
+	return strings.HasSuffix(strings.ToLower(file), rulesSuffix)
+}
+
+// rulesSidecar returns the rules file of a route file.
+func rulesSidecar(file string) string {
+	return strings.TrimSuffix(schemaSidecar(file), schemaSuffix) + rulesSuffix
+}
+
+type cachedRules struct {
+	modified time.Time
+	rules    *mockRules
+	err      error
+}
+
+var (
+	rulesCacheLock sync.Mutex
+	rulesCache     = make(map[string]cachedRules) // rules file -> parsed rules
+)
+
+// loadMockRules returns the rules of file, nil when it has none. The rules
+// file is parsed again only when it changes, and its errors are logged then.
+func loadMockRules(file string) (*mockRules, error) {
+	sidecar := rulesSidecar(file)
+	stat, err := os.Stat(sidecar)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	rulesCacheLock.Lock()
+	cached, ok := rulesCache[sidecar]
+	rulesCacheLock.Unlock()
+	if ok && cached.modified.Equal(stat.ModTime()) {
+		return cached.rules, cached.err
+	}
+
+	rules, err := parseMockRules(sidecar)
+	if err != nil {
+		log.Printf("%v", err)
+		Lg.Errorf("%v", err) // once per change, requests of the route then answer 500
+	}
+	rulesCacheLock.Lock()
+	rulesCache[sidecar] = cachedRules{modified: stat.ModTime(), rules: rules, err: err}
+	rulesCacheLock.Unlock()
+	return rules, err
+}
+
+// parseMockRules reads a rules file. Rules are sorted by priority, rules of
+// equal priority keep their order.
+func parseMockRules(sidecar string) (*mockRules, error) {
+	data, err := ioutil.ReadFile(sidecar)
+	if err != nil {
+		return nil, err
+	}
+	rules := &mockRules{}
+	if err := json.Unmarshal(data, rules); err != nil {
+		return nil, fmt.Errorf("invalid rules file %s: %v", sidecar, err)
+	}
+	if rules.Limit != nil {
+		if err := rules.Limit.validate(); err != nil {
+			return nil, fmt.Errorf("rate limit in %s: %v", sidecar, err)
+		}
+	}
+	for i := range rules.Rules {
+		rule := &rules.Rules[i]
+		if rule.Name == "" {
+			rule.Name = "#" + strconv.Itoa(i+1)
+		}
+		if err := rule.compile(filepath.Dir(sidecar)); err != nil {
+			return nil, fmt.Errorf("rule %s in %s: %v", rule.Name, sidecar, err)
+		}
+	}
+	sort.SliceStable(rules.Rules, func(i, j int) bool { return rules.Rules[i].Priority > rules.Rules[j].Priority })
+	if rules.Default != nil {
+		rules.Default.Name = "default"
+		if err := rules.Default.compile(filepath.Dir(sidecar)); err != nil {
+			return nil, fmt.Errorf("default rule in %s: %v", sidecar, err)
+		}
+	}
+	return rules, nil
+}
+
+func (rule *mockRule) compile(dir string) error {
+	var err error
+	if rule.Delay != "" {
+		if rule.delay, err = time.ParseDuration(rule.Delay); err != nil {
+			return fmt.Errorf("invalid delay %q", rule.Delay)
+		}
+	}
+	if rule.File != "" && !filepath.IsAbs(rule.File) {
+		rule.File = filepath.Join(dir, rule.File)
+	}
+	sources := []struct {
+		name   string
+		values map[string]interface{}
+	}{
+		{"query", rule.Match.Query}, {"headers", rule.Match.Headers}, {"cookies", rule.Match.Cookies},
+		{"path", rule.Match.Path}, {"body", rule.Match.Body}, {"claims", rule.Match.Claims},
+	}
+	for _, source := range sources {
+		for key, expected := range source.values {
+			matcher := valueMatcher{source: source.name, key: key, value: expected}
+			if source.name == "body" {
+				matcher.key = strings.TrimPrefix(strings.TrimPrefix(key, "$"), ".")
+				matcher.key = strings.NewReplacer("[", ".", "]", "").Replace(matcher.key)
+			}
+			switch v := expected.(type) {
+			case string:
+				matcher.any = v == "*"
+			case map[string]interface{}:
+				if pattern, ok := v["regex"].(string); ok && len(v) == 1 {
+					if matcher.regex, err = regexp.Compile(pattern); err != nil {
+						return fmt.Errorf("invalid regex %q: %v", pattern, err)
+					}
+				}
+			}
+			if source.name != "body" && source.name != "claims" && matcher.regex == nil {
+				if _, ok := expected.(string); !ok {
+					return fmt.Errorf("%s %q must be a string or {\"regex\": ...}", source.name, key)
+				}
+			}
+			rule.matchers = append(rule.matchers, matcher)
+		}
+	}
+	return nil
+}
+
+// matches reports whether the rule applies to the request.
+func (rule *mockRule) matches(req *ruleRequest) bool {
+	if rule.Method != "" && !strings.EqualFold(rule.Method, req.r.Method) {
+		return false
+	}
+	for _, matcher := range rule.matchers {
+		if !matcher.matches(req) {
+			return false
+		}
+	}
+	return true
+}
+
+func (m valueMatcher) matches(req *ruleRequest) bool {
+	var candidates []interface{}
+	switch m.source {
+	case "query":
+		for _, v := range req.r.URL.Query()[m.key] {
+			candidates = append(candidates, v)
+		}
+	case "headers":
+		for _, v := range req.r.Header.Values(m.key) {
+			candidates = append(candidates, v)
+		}
+	case "cookies":
+		if cookie, err := req.r.Cookie(m.key); err == nil {
+			candidates = append(candidates, cookie.Value)
+		}
+	case "path":
+		if v, ok := mux.Vars(req.r)[m.key]; ok {
+			candidates = append(candidates, v)
+		}
+	case "body":
+		if v, ok := lookupJSONPath(req.body, m.key); ok {
+			candidates = append(candidates, v)
+		}
+	case "claims":
+		if v, ok := lookupJSONPath(requestClaims(req.r), m.key); ok {
+			if list, isList := v.([]interface{}); isList {
+				candidates = append(candidates, list...) // "roles": ["admin", "ops"] matches "admin"
+			} else if scope, isScope := v.(string); isScope && m.key == "scope" {
+				for _, s := range strings.Fields(scope) {
+					candidates = append(candidates, s)
+				}
+			} else {
+				candidates = append(candidates, v)
+			}
+		}
+	}
+	for _, candidate := range candidates {
+		switch {
+		case m.any:
+			return true
+		case m.regex != nil:
+			if m.regex.MatchString(jsonText(candidate)) {
+				return true
+			}
+		case jsonValuesEqual(candidate, m.value):
+			return true
+		}
+	}
+	return false
+}
+
+// jsonText returns strings as they are and other values as JSON.
+func jsonText(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// newRuleRequest reads what the rules and inline bodies need from r. body is
+// the request body already read by the handler.
+func newRuleRequest(r *http.Request, body []byte) *ruleRequest {
+	req := &ruleRequest{r: r}
+	if len(body) > 0 {
+		json.Unmarshal(body, &req.body)
+	}
+	query := map[string]string{}
+	for name, values := range r.URL.Query() {
+		query[name] = values[0]
+	}
+	headers := map[string]string{}
+	for name, values := range r.Header {
+		headers[strings.ToLower(name)] = values[0]
+	}
+	cookies := map[string]string{}
+	for _, cookie := range r.Cookies() {
+		cookies[cookie.Name] = cookie.Value
+	}
+	req.values = map[string]interface{}{
+		"query": query, "headers": headers, "cookies": cookies,
+		"path": mux.Vars(r), "body": req.body, "method": r.Method, "claims": requestClaims(r),
+	}
+	return req
+}
+
+// serveMatchingRule answers r with the first matching rule of file, or its
+// default rule. It returns false when the route should respond as usual,
+// through the returned writer which applies the status and headers of a
+// rule without a file or body.
+func serveMatchingRule(w http.ResponseWriter, r *http.Request, file string, body []byte, status int) (http.ResponseWriter, bool) {
+	rules, err := loadMockRules(file)
+	if err != nil {
+		Lg.Errorf("%v", err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return w, true
+	}
+	if rules == nil || (len(rules.Rules) == 0 && rules.Default == nil) {
+		return w, false // e.g. a rules file with only a CORS policy or rate limit
+	}
+	req := newRuleRequest(r, body)
+	selected := rules.Default
+	for i := range rules.Rules {
+		if rules.Rules[i].matches(req) {
+			selected = &rules.Rules[i]
+			break
+		}
+	}
+	if selected == nil {
+		w.Header().Set(ruleHeader, "none")
+		return w, false
+	}
+	w.Header().Set(ruleHeader, selected.Name)
+	ctx := newTemplateContext(req.values)
+	for name, value := range selected.Headers {
+		w.Header().Set(name, ctx.renderText(value))
+	}
+	if selected.delay > 0 {
+		time.Sleep(selected.delay)
+	}
+
+	var content []byte
+	switch {
+	case selected.File != "":
+		if content, err = ioutil.ReadFile(selected.File); err != nil {
+			Lg.Errorf("Error reading file %s of rule %s: %v", selected.File, selected.Name, err)
+			writeJSONError(w, http.StatusInternalServerError, fmt.Sprintf("rule %s: %v", selected.Name, err))
+			return w, true
+		}
+		if len(mux.Vars(r)) > 0 && strings.Contains(string(content), "{{") {
+			// Files of parameterised routes are templates, as the route file is
+			var template interface{}
+			if json.Unmarshal(content, &template) == nil {
+				if data, err := json.Marshal(ctx.renderTemplate(template)); err == nil {
+					content = data
+				}
+			}
+		}
+	case selected.Body != nil:
+		if content, err = json.Marshal(ctx.renderTemplate(selected.Body)); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return w, true
+		}
+	case selected.Status != 0:
+		return &ruleStatusWriter{ResponseWriter: w, status: selected.Status}, false
+	default:
+		return w, false
+	}
+
+	if selected.Status != 0 {
+		status = selected.Status
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(content)
+	log.Printf("Rule %s answered %s %s", selected.Name, r.Method, r.URL.Path)
+	Lg.Infof("Rule %s answered %s %s", selected.Name, r.Method, r.URL.Path)
+	return w, true
+}
+
+// createRuleHandler answers the methods the route file does not serve itself,
+// e.g. a recorded DELETE, with the rules of the route. Without a matching rule
+// HEAD is answered like GET and other methods go to methodNotAllowed.
+func createRuleHandler(route string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		file, ok := routeFile(route)
+		if !ok {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		if !isWebSocketMockFile(file) {
+			body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+			if err != nil {
+				writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body)) // still forwarded by the proxy
+			var handled bool
+			if w, handled = serveMatchingRule(w, r, file, body, http.StatusOK); handled {
+				return
+			}
+			if _, statusOnly := w.(*ruleStatusWriter); statusOnly {
+				w.WriteHeader(http.StatusOK) // replaced by the status of the rule
+				return
+			}
+		}
+		if r.Method == http.MethodHead {
+			createFileHandler(route)(w, r)
+			return
+		}
+		methodNotAllowed(w, r)
+	}
+}
+
+// ruleStatusWriter replaces the success status of the usual response of a
+// route, error statuses are kept.
+type ruleStatusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *ruleStatusWriter) WriteHeader(status int) {
+	if status >= 200 && status < 300 {
+		status = w.status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *ruleStatusWriter) Write(b []byte) (int, error) {
+	return w.ResponseWriter.Write(b)
+}
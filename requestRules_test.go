@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+func TestMockRuleMatches(t *testing.T) {
+	tests := []struct {
+		name string
+		rule string
+		want bool
+	}{
+		{"any request", `{}`, true},
+		{"method", `{"method": "post"}`, true},
+		{"other method", `{"method": "DELETE"}`, false},
+		{"query", `{"match": {"query": {"role": "admin"}}}`, true},
+		{"other query value", `{"match": {"query": {"role": "guest"}}}`, false},
+		{"missing query", `{"match": {"query": {"page": "*"}}}`, false},
+		{"any header", `{"match": {"headers": {"X-Tenant": "*"}}}`, true},
+		{"header regex", `{"match": {"headers": {"X-Tenant": {"regex": "^acme-[0-9]+$"}}}}`, true},
+		{"cookie", `{"match": {"cookies": {"session": "abc"}}}`, true},
+		{"path parameter", `{"match": {"path": {"id": "42"}}}`, true},
+		{"body number", `{"match": {"body": {"$.user.age": 30}}}`, true},
+		{"body string", `{"match": {"body": {"$.items[0].sku": "A1"}}}`, true},
+		{"body boolean", `{"match": {"body": {"user.active": false}}}`, false},
+		{"claims list", `{"match": {"claims": {"roles": "ops"}}}`, true},
+		{"claims scope", `{"match": {"claims": {"scope": "write"}}}`, true},
+		{"every matcher", `{"method": "POST", "match": {"query": {"role": "admin"}, "claims": {"sub": "bob"}}}`, false},
+	}
+	body := `{"user": {"age": 30, "active": true}, "items": [{"sku": "A1"}]}`
+	for _, tt := range tests {
+		rule := &mockRule{}
+		if err := json.Unmarshal([]byte(tt.rule), rule); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if err := rule.compile("."); err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		r := httptest.NewRequest(http.MethodPost, "/users/42?role=admin", strings.NewReader(body))
+		r.Header.Set("X-Tenant", "acme-7")
+		r.AddCookie(&http.Cookie{Name: "session", Value: "abc"})
+		r = mux.SetURLVars(r, map[string]string{"id": "42"})
+		principal := &authPrincipal{Scheme: "bearer", Claims: map[string]interface{}{"sub": "alice", "roles": []interface{}{"admin", "ops"}, "scope": "read write"}}
+		r = r.WithContext(context.WithValue(r.Context(), authKey{}, principal))
+		if got := rule.matches(newRuleRequest(r, []byte(body))); got != tt.want {
+			t.Errorf("%s: matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMockRuleCompileErrors(t *testing.T) {
+	for _, rule := range []string{
+		`{"delay": "soon"}`,
+		`{"match": {"query": {"page": 2}}}`,
+		`{"match": {"headers": {"X-Id": {"regex": "("}}}}`,
+	} {
+		parsed := &mockRule{}
+		if err := json.Unmarshal([]byte(rule), parsed); err != nil {
+			t.Fatal(err)
+		}
+		if err := parsed.compile("."); err == nil {
+			t.Errorf("%s compiled without error", rule)
+		}
+	}
+}
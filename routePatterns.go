@@ -0,0 +1,198 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const catchAllSuffix = "...}" // last segment of /files/{rest...}
+
+var (
+	fileRouter    *mux.Router    // literal file routes, tried before any parameterised route
+	routePatterns []routePattern // parameterised routes in precedence order, guarded by routesLock
+)
+
+// routePattern is a route with parameters such as /users/{id}, or its
+// /users/{id}/stream when stream is set.
+type routePattern struct {
+	route    string
+	segments []string
+	stream   bool
+}
+
+// routeForPath turns the path of a JSON file relative to the served folder
+// into its route: users/[id].json and users/_id.json are both served at
+// /users/{id}, [...rest].json catches every remaining path segment. Files at
+// the root keep their literal name, a parameter there would answer every path.
+func routeForPath(rel string) string {
+	name := filepath.ToSlash(rel)
+	if isWebSocketMockFile(name) {
+		name = name[:len(name)-len(wsMockSuffix)]
+	} else {
+		name = strings.TrimSuffix(name, filepath.Ext(name))
+	}
+	segments := strings.Split(name, "/")
+	if len(segments) == 1 {
+		return "/" + name
+	}
+	for i, segment := range segments {
+		switch {
+		case strings.HasPrefix(segment, "[...") && strings.HasSuffix(segment, "]") && i == len(segments)-1:
+			segments[i] = "{" + segment[4:len(segment)-1] + catchAllSuffix
+		case strings.HasPrefix(segment, "[") && strings.HasSuffix(segment, "]") && len(segment) > 2:
+			segments[i] = "{" + segment[1:len(segment)-1] + "}"
+		case strings.HasPrefix(segment, "_") && len(segment) > 1:
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return "/" + strings.Join(segments, "/")
+}
+
+// isPatternRoute reports whether route has path parameters.
+func isPatternRoute(route string) bool {
+	return strings.Contains(route, "{")
+}
+
+// segmentRank orders route segments: literal, then parameter, then catch-all.
+func segmentRank(segment string) int {
+	switch {
+	case strings.HasSuffix(segment, catchAllSuffix):
+		return 2
+	case strings.HasPrefix(segment, "{"):
+		return 1
+	}
+	return 0
+}
+
+// buildRoutePatterns sorts the parameterised routes so the most specific one
+// wins: segments are compared from the left, a literal beats a parameter and a
+// parameter beats a catch-all. Ties are broken by the route text.
+func buildRoutePatterns(routeList map[string]bool) []routePattern {
+	var patterns []routePattern
+	for route := range routeList {
+		if !isPatternRoute(route) {
+			continue
+		}
+		segments := strings.Split(strings.TrimPrefix(route, "/"), "/")
+		patterns = append(patterns, routePattern{route: route, segments: segments})
+		if !strings.HasSuffix(route, catchAllSuffix) {
+			stream := append(append([]string{}, segments...), strings.TrimPrefix(streamSuffix, "/"))
+			patterns = append(patterns, routePattern{route: route, segments: stream, stream: true})
+		}
+	}
+	sort.Slice(patterns, func(i, j int) bool {
+		a, b := patterns[i].segments, patterns[j].segments
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if ra, rb := segmentRank(a[k]), segmentRank(b[k]); ra != rb {
+				return ra < rb
+			}
+		}
+		if len(a) != len(b) {
+			return len(a) > len(b)
+		}
+		if patterns[i].route != patterns[j].route {
+			return patterns[i].route < patterns[j].route
+		}
+		return !patterns[i].stream
+	})
+	return patterns
+}
+
+// match returns the path parameters when path matches the pattern.
+func (p routePattern) match(path string) (map[string]string, bool) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	vars := make(map[string]string)
+	for i, segment := range p.segments {
+		if i >= len(parts) || parts[i] == "" {
+			return nil, false
+		}
+		switch segmentRank(segment) {
+		case 2:
+			vars[segment[1:len(segment)-len(catchAllSuffix)]] = strings.Join(parts[i:], "/")
+			return vars, true
+		case 1:
+			vars[segment[1:len(segment)-1]] = parts[i]
+		default:
+			if segment != parts[i] {
+				return nil, false
+			}
+		}
+	}
+	return vars, len(parts) == len(p.segments)
+}
+
+// findRoutePattern returns the first parameterised route matching path.
+func findRoutePattern(path string) (routePattern, map[string]string, bool) {
+	routesLock.RLock()
+	defer routesLock.RUnlock()
+	for _, pattern := range routePatterns {
+		if vars, ok := pattern.match(path); ok {
+			return pattern, vars, true
+		}
+	}
+	return routePattern{}, nil, false
+}
+
+// matchRoutePattern is the mux matcher of the parameterised routes.
+func matchRoutePattern(r *http.Request, rm *mux.RouteMatch) bool {
+	_, _, ok := findRoutePattern(r.URL.Path)
+	return ok
+}
+
+// serveRoutePattern answers the requests of parameterised routes with the
+// handlers of literal routes, the parameters are read with mux.Vars.
+func serveRoutePattern(w http.ResponseWriter, r *http.Request) {
+	pattern, vars, ok := findRoutePattern(r.URL.Path)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	r = mux.SetURLVars(r, vars)
+	switch {
+	case pattern.stream && r.Method == http.MethodGet:
+		createStreamHandler(pattern.route)(w, r)
+	case pattern.stream:
+		methodNotAllowed(w, r)
+	case r.Method == http.MethodGet:
+		createFileHandler(pattern.route)(w, r)
+	case r.Method == http.MethodPost, r.Method == http.MethodPut, r.Method == http.MethodPatch:
+		createWriteHandler(pattern.route)(w, r)
+	default:
+		createRuleHandler(pattern.route)(w, r)
+	}
+}
+
+// openAPIRoute writes a route in OpenAPI path syntax, /files/{rest...} becomes /files/{rest}.
+func openAPIRoute(route string) string {
+	return strings.ReplaceAll(route, catchAllSuffix, "}")
+}
+
+// routeParameters lists the parameter names of route.
+func routeParameters(route string) []string {
+	var names []string
+	for _, segment := range strings.Split(route, "/") {
+		if strings.HasPrefix(segment, "{") {
+			names = append(names, strings.TrimSuffix(strings.Trim(segment, "{}"), "..."))
+		}
+	}
+	return names
+}
+
+// skipServedDir reports whether a folder below the served folder is left out
+// of the scan: hidden folders and the sample folder, which is scanned apart.
+func skipServedDir(path string, info os.FileInfo) bool {
+	if strings.HasPrefix(info.Name(), ".") || info.Name() == "node_modules" {
+		return true
+	}
+	samplesAbs, err := filepath.Abs(samplesDir)
+	if err != nil {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	return err == nil && abs == samplesAbs
+}
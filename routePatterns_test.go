@@ -0,0 +1,69 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRouteForPath(t *testing.T) {
+	tests := map[string]string{
+		"users.json":            "/users",
+		"users/[id].json":       "/users/{id}",
+		"users/_id.json":        "/users/{id}",
+		"users/[id]/posts.json": "/users/{id}/posts",
+		"files/[...rest].json":  "/files/{rest...}",
+		"chat.ws.json":          "/chat",
+		"[id].json":             "/[id]", // parameters at the root would answer every path
+		"_id.json":              "/_id",
+	}
+	for rel, want := range tests {
+		if got := routeForPath(rel); got != want {
+			t.Errorf("routeForPath(%q) = %q, want %q", rel, got, want)
+		}
+	}
+}
+
+func TestFindRoutePattern(t *testing.T) {
+	saved := routePatterns
+	t.Cleanup(func() { routePatterns = saved })
+	routePatterns = buildRoutePatterns(map[string]bool{
+		"/users":             true,
+		"/users/{id}":        true,
+		"/users/me/{tab}":    true,
+		"/users/{id}/posts":  true,
+		"/files/{rest...}":   true,
+		"/{section}/summary": true,
+	})
+
+	tests := []struct {
+		path   string
+		route  string
+		stream bool
+		vars   map[string]string
+	}{
+		{"/users/42", "/users/{id}", false, map[string]string{"id": "42"}},
+		{"/users/me/settings", "/users/me/{tab}", false, map[string]string{"tab": "settings"}},
+		{"/users/42/posts", "/users/{id}/posts", false, map[string]string{"id": "42"}},
+		{"/users/42/stream", "/users/{id}", true, map[string]string{"id": "42"}},
+		{"/files/a/b/c.txt", "/files/{rest...}", false, map[string]string{"rest": "a/b/c.txt"}},
+		{"/reports/summary", "/{section}/summary", false, map[string]string{"section": "reports"}},
+		{"/users", "", false, nil},
+		{"/users/", "", false, nil},
+		{"/files", "", false, nil},
+		{"/users/42/posts/7", "", false, nil},
+	}
+	for _, tt := range tests {
+		pattern, vars, ok := findRoutePattern(tt.path)
+		if ok != (tt.route != "") {
+			t.Errorf("findRoutePattern(%q) found %v, want %q", tt.path, ok, tt.route)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if pattern.route != tt.route || pattern.stream != tt.stream || !reflect.DeepEqual(vars, tt.vars) {
+			t.Errorf("findRoutePattern(%q) = %s (stream %v) %v, want %s (stream %v) %v",
+				tt.path, pattern.route, pattern.stream, vars, tt.route, tt.stream, tt.vars)
+		}
+	}
+}
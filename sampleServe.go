@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+const (
+	sampleSuffix        = ".sample.json"
+	defaultSampleCount  = 10
+	maxGeneratedRecords = 10000
+)
+
+// isSampleFile reports whether file is a sample served as generated records.
+func isSampleFile(file string) bool {
+	return strings.HasSuffix(strings.ToLower(file), sampleSuffix)
+}
+
+// scanSampleDirectory adds a route for every *.sample.json file in the sample
+// folder. Plain JSON files win when both define the same route.
+func scanSampleDirectory(newRoutes map[string]string) {
+	files, err := ioutil.ReadDir(samplesDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			Lg.Errorf("Error reading sample folder %s: %v", samplesDir, err)
+		}
+		return
+	}
+
+	for _, file := range files {
+		if file.IsDir() || !isSampleFile(file.Name()) {
+			continue
+		}
+		routePath := "/" + file.Name()[:len(file.Name())-len(sampleSuffix)]
+		if existing, ok := newRoutes[routePath]; ok {
+			Lg.Warnf("Sample %s is ignored, route %s is already served by %s", file.Name(), routePath, existing)
+			continue
+		}
+		newRoutes[routePath] = filepath.Join(samplesDir, file.Name())
+	}
+}
+
+// loadSampleTemplate reads a sample file and returns the record template.
+// When the sample is an array its first element is used.
+func loadSampleTemplate(file string) (interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var sample interface{}
+	if err := json.Unmarshal(data, &sample); err != nil {
+		return nil, fmt.Errorf("invalid JSON in %s: %v", file, err)
+	}
+	if items, ok := sample.([]interface{}); ok && len(items) > 0 {
+		sample = items[0]
+	}
+	return sample, nil
+}
+
+// sampleWindow is the part of a generated dataset requested by a client.
+type sampleWindow struct {
+	Total  int    // size of the whole dataset, from ?count=
+	Offset int    // index of the first record returned
+	Limit  int    // number of records returned
+	Seed   uint64 // from ?seed=, 0 means random
+}
+
+// parseSampleWindow reads count, seed, page and limit from the query string.
+// Without page/limit the whole dataset is returned.
+func parseSampleWindow(r *http.Request) (sampleWindow, error) {
+	q := r.URL.Query()
+	win := sampleWindow{Total: defaultSampleCount}
+	var err error
+	if v := q.Get("count"); v != "" {
+		if win.Total, err = strconv.Atoi(v); err != nil || win.Total < 0 {
+			return win, fmt.Errorf("invalid count %q", v)
+		}
+	}
+	if v := q.Get("seed"); v != "" {
+		if win.Seed, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return win, fmt.Errorf("invalid seed %q", v)
+		}
+	}
+
+	page, limit := 1, win.Total
+	if v := firstQueryValue(q, "limit", "_limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 0 {
+			return win, fmt.Errorf("invalid limit %q", v)
+		}
+	} else if firstQueryValue(q, "page", "_page") != "" {
+		limit = defaultSampleCount
+	}
+	if v := firstQueryValue(q, "page", "_page"); v != "" {
+		if page, err = strconv.Atoi(v); err != nil || page < 1 {
+			return win, fmt.Errorf("invalid page %q", v)
+		}
+	}
+
+	if last := (win.Total + limit - 1) / max(limit, 1); page > max(last, 1) {
+		// Also keeps (page - 1) * limit from overflowing
+		return win, fmt.Errorf("invalid page %d, the last page is %d", page, max(last, 1))
+	}
+	win.Offset = (page - 1) * limit
+	if win.Offset > win.Total {
+		win.Offset = win.Total
+	}
+	win.Limit = limit
+	if win.Offset+win.Limit > win.Total {
+		win.Limit = win.Total - win.Offset
+	}
+	if win.Limit > maxGeneratedRecords {
+		return win, fmt.Errorf("too many records requested, use page and limit for more than %d", maxGeneratedRecords)
+	}
+	return win, nil
+}
+
+func firstQueryValue(q map[string][]string, names ...string) string {
+	for _, name := range names {
+		if v := q[name]; len(v) > 0 && v[0] != "" {
+			return v[0]
+		}
+	}
+	return ""
+}
+
+// generateWindow generates the records of win from template. With a seed every
+// record is seeded by its index, so pages of the same dataset stay consistent.
+func generateWindow(template interface{}, win sampleWindow) ([]interface{}, error) {
+	gen, err := newGeneratorFromFlags()
+	if err != nil {
+		return nil, err
+	}
+	for _, seq := range gen.Sequences {
+		seq.Start += int64(win.Offset) * seq.Step
+	}
+
+	records := make([]interface{}, 0, win.Limit)
+	for i := 0; i < win.Limit; i++ {
+		if win.Seed != 0 {
+			gen.Faker = gofakeit.New(win.Seed*0x9E3779B97F4A7C15 + uint64(win.Offset+i) + 1)
+		}
+		records = append(records, gen.NewRecord(template))
+	}
+	return records, nil
+}
+
+// serveGeneratedRecords answers a request to a sample route with fresh fake records.
+func serveGeneratedRecords(w http.ResponseWriter, r *http.Request, file string) {
+	template, err := loadSampleTemplate(file)
+	if err != nil {
+		Lg.Errorf("Error reading sample file %s: %v", file, err)
+		http.Error(w, "Sample file not readable", http.StatusInternalServerError)
+		return
+	}
+	win, err := parseSampleWindow(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	records, err := generateWindow(template, win)
+	if err != nil {
+		Lg.Errorf("Error generating records from %s: %v", file, err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(win.Total))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(records)
+	log.Printf("Generated %d records from sample %s.", len(records), file)
+	Lg.Infof("Generated %d records from sample %s.", len(records), file)
+}
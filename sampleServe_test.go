@@ -0,0 +1,74 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestParseSampleWindow(t *testing.T) {
+	tests := []struct {
+		query string
+		want  sampleWindow
+		ok    bool
+	}{
+		{"", sampleWindow{Total: 10, Limit: 10}, true},
+		{"count=25&seed=7", sampleWindow{Total: 25, Limit: 25, Seed: 7}, true},
+		{"count=25&page=2", sampleWindow{Total: 25, Offset: 10, Limit: 10}, true},
+		{"count=25&_page=3&_limit=10", sampleWindow{Total: 25, Offset: 20, Limit: 5}, true},
+		{"count=0&page=1", sampleWindow{}, true},
+		{"count=25&limit=0&page=1", sampleWindow{Total: 25}, true},
+		{"count=100000&limit=50&page=2000", sampleWindow{Total: 100000, Offset: 99950, Limit: 50}, true},
+		{"count=25&limit=10&page=4", sampleWindow{}, false},
+		{"count=25&limit=10&page=922337203685477581", sampleWindow{}, false},
+		{"count=20000", sampleWindow{}, false},
+		{"count=-1", sampleWindow{}, false},
+		{"page=0", sampleWindow{}, false},
+		{"limit=x", sampleWindow{}, false},
+		{"seed=-3", sampleWindow{}, false},
+	}
+	for _, tt := range tests {
+		win, err := parseSampleWindow(httptest.NewRequest(http.MethodGet, "/users?"+tt.query, nil))
+		if (err == nil) != tt.ok {
+			t.Errorf("%q: error = %v, want ok %v", tt.query, err, tt.ok)
+			continue
+		}
+		if tt.ok && win != tt.want {
+			t.Errorf("%q: window %+v, want %+v", tt.query, win, tt.want)
+		}
+	}
+}
+
+func TestGenerateWindowPagesAreConsistent(t *testing.T) {
+	template := map[string]interface{}{"name": "x", "email": "x@y.z", "age": 30.0}
+	all, err := generateWindow(template, sampleWindow{Total: 10, Limit: 10, Seed: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, err := generateWindow(template, sampleWindow{Total: 10, Offset: 4, Limit: 3, Seed: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(page, all[4:7]) {
+		t.Errorf("records 4-6 differ from the whole seeded dataset:\n%v\n%v", page, all[4:7])
+	}
+}
+
+func TestServeGeneratedRecords(t *testing.T) {
+	dir := t.TempDir()
+	file := dir + "/users.sample.json"
+	if err := writeFileAtomic(file, []byte(`[{"id": 1, "name": "x"}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	serveGeneratedRecords(w, httptest.NewRequest(http.MethodGet, "/users?count=42&limit=5&page=2", nil), file)
+	if w.Code != http.StatusOK || w.Header().Get("X-Total-Count") != "42" {
+		t.Fatalf("status %d, X-Total-Count %q", w.Code, w.Header().Get("X-Total-Count"))
+	}
+	w = httptest.NewRecorder()
+	serveGeneratedRecords(w, httptest.NewRequest(http.MethodGet, "/users?limit=5&page=99999999999999999", nil), file)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("page past the end: status %d, want 400", w.Code)
+	}
+}
@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/santhosh-tekuri/jsonschema/v6"
+)
+
+const (
+	schemaSuffix   = ".schema.json"
+	maxRequestBody = 1 << 20
+)
+
+// Keywords telling a plain JSON Schema apart from a {"body", "query", "headers"} sidecar.
+var schemaKeywords = []string{"$schema", "$ref", "type", "properties", "items", "allOf", "anyOf", "oneOf", "enum", "const"}
+
+// routeSchema validates the requests sent to the write methods of a route.
+type routeSchema struct {
+	Source  string // sidecar file, or the file whose shape is enforced with -strict
+	Body    *jsonschema.Schema
+	Patch   *jsonschema.Schema // body of PATCH requests when it differs from Body
+	Query   *jsonschema.Schema
+	Headers *jsonschema.Schema
+	raw     map[string]interface{} // query and headers schemas, used to convert parameter types
+}
+
+// schemaError is one entry of the error list of a rejected request.
+type schemaError struct {
+	In      string `json:"in"` // body, query or headers
+	Pointer string `json:"pointer"`
+	Message string `json:"message"`
+}
+
+type cachedSchema struct {
+	modified time.Time
+	schema   *routeSchema
+}
+
+var (
+	schemaCacheLock sync.Mutex
+	schemaCache     = make(map[string]cachedSchema) // sidecar file -> compiled schema
+)
+
+// isSchemaFile reports whether file is a sidecar schema, which is not served as a route.
+func isSchemaFile(file string) bool {
+	return strings.HasSuffix(strings.ToLower(file), schemaSuffix)
+}
+
+// schemaSidecar returns the schema file of a route file, users.json and
+// users.sample.json are both validated by users.schema.json next to them.
+func schemaSidecar(file string) string {
+	lower := strings.ToLower(file)
+	for _, suffix := range []string{sampleSuffix, ".json"} {
+		if strings.HasSuffix(lower, suffix) {
+			return file[:len(file)-len(suffix)] + schemaSuffix
+		}
+	}
+	return file + schemaSuffix
+}
+
+// loadRouteSchema returns the schema validating writes to file: its sidecar
+// when there is one, the shape inferred from the file with -strict, else nil.
+func loadRouteSchema(file string) (*routeSchema, error) {
+	sidecar := schemaSidecar(file)
+	stat, err := os.Stat(sidecar)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		if strictShape {
+			return inferRouteSchema(file)
+		}
+		return nil, nil
+	}
+
+	schemaCacheLock.Lock()
+	cached, ok := schemaCache[sidecar]
+	schemaCacheLock.Unlock()
+	if ok && cached.modified.Equal(stat.ModTime()) {
+		return cached.schema, nil
+	}
+
+	schema, err := compileSidecar(sidecar)
+	if err != nil {
+		return nil, err
+	}
+	schemaCacheLock.Lock()
+	schemaCache[sidecar] = cachedSchema{modified: stat.ModTime(), schema: schema}
+	schemaCacheLock.Unlock()
+	return schema, nil
+}
+
+// compileSidecar compiles a sidecar file. It is either a JSON Schema of the
+// request body, or an object with "body", "query" and "headers" schemas.
+func compileSidecar(sidecar string) (*routeSchema, error) {
+	data, err := ioutil.ReadFile(sidecar)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := jsonschema.UnmarshalJSON(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("invalid JSON in %s: %v", sidecar, err)
+	}
+	abs, err := filepath.Abs(sidecar)
+	if err != nil {
+		return nil, err
+	}
+	url := "file://" + filepath.ToSlash(abs)
+
+	compiler := jsonschema.NewCompiler()
+	compiler.AssertFormat()
+	if err := compiler.AddResource(url, doc); err != nil {
+		return nil, fmt.Errorf("invalid schema %s: %v", sidecar, err)
+	}
+
+	schema := &routeSchema{Source: filepath.Base(sidecar), raw: map[string]interface{}{}}
+	object, _ := doc.(map[string]interface{})
+	if !isSplitSchema(object) {
+		if schema.Body, err = compiler.Compile(url); err != nil {
+			return nil, fmt.Errorf("invalid schema %s: %v", sidecar, err)
+		}
+		return schema, nil
+	}
+	for name, target := range map[string]**jsonschema.Schema{"body": &schema.Body, "query": &schema.Query, "headers": &schema.Headers} {
+		if _, ok := object[name]; !ok {
+			continue
+		}
+		if *target, err = compiler.Compile(url + "#/" + name); err != nil {
+			return nil, fmt.Errorf("invalid %s schema in %s: %v", name, sidecar, err)
+		}
+		schema.raw[name] = object[name]
+	}
+	return schema, nil
+}
+
+func isSplitSchema(object map[string]interface{}) bool {
+	if object == nil {
+		return false
+	}
+	for _, keyword := range schemaKeywords {
+		if _, ok := object[keyword]; ok {
+			return false
+		}
+	}
+	for _, name := range []string{"body", "query", "headers"} {
+		if _, ok := object[name]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// inferRouteSchema builds the strict shape of file: a body must have every
+// field of the file (of its elements for an array) with the same types.
+func inferRouteSchema(file string) (*routeSchema, error) {
+	elements, _, err := loadStreamElements(file)
+	if err != nil {
+		return nil, err
+	}
+	shape := inferShape(elements).Elem
+
+	// A PATCH body may leave out fields but not add or retype them
+	compiler := jsonschema.NewCompiler()
+	if err := compiler.AddResource("inferred.json", strictSchema(shape, false)); err != nil {
+		return nil, err
+	}
+	if err := compiler.AddResource("inferred-patch.json", strictSchema(shape, true)); err != nil {
+		return nil, err
+	}
+	schema := &routeSchema{Source: "the shape of " + filepath.Base(file)}
+	if schema.Body, err = compiler.Compile("inferred.json"); err != nil {
+		return nil, err
+	}
+	if schema.Patch, err = compiler.Compile("inferred-patch.json"); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+// strictSchema converts an inferred shape into a JSON Schema without extra
+// fields, every field is required unless partial.
+func strictSchema(shape *jsonShape, partial bool) map[string]interface{} {
+	switch shape.Kind {
+	case "object":
+		properties := make(map[string]interface{}, len(shape.Fields))
+		required := make([]interface{}, 0, len(shape.Order))
+		for _, key := range shape.Order {
+			properties[key] = strictSchema(shape.Fields[key], partial)
+			required = append(required, key)
+		}
+		schema := map[string]interface{}{
+			"type":                 "object",
+			"properties":           properties,
+			"additionalProperties": false,
+		}
+		if !partial {
+			schema["required"] = required
+		}
+		return schema
+	case "list":
+		return map[string]interface{}{"type": "array", "items": strictSchema(shape.Elem, partial)}
+	case "null":
+		return map[string]interface{}{}
+	}
+	switch shape.Scalar {
+	case "Int", "Int64":
+		return map[string]interface{}{"type": "integer"}
+	case "Float":
+		return map[string]interface{}{"type": "number"}
+	case "String":
+		return map[string]interface{}{"type": "string"}
+	case "Boolean":
+		return map[string]interface{}{"type": "boolean"}
+	}
+	return map[string]interface{}{}
+}
+
+// createWriteHandler accepts POST, PUT and PATCH requests on the route of a
+// JSON file. A matching rule of the route answers first, else the request is
+// validated against the schema of the route and echoed back. The file is
+// left unchanged. Routes without a schema or matching rule answer 405, or
+// forward the request to the -proxy upstream.
+func createWriteHandler(route string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		file, ok := routeFile(route)
+		if !ok {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		if isWebSocketMockFile(file) {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		schema, err := loadRouteSchema(file)
+		if err != nil {
+			Lg.Errorf("Error loading schema of %s: %v", file, err)
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+		if err != nil {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, err.Error())
+			return
+		}
+
+		// Rules answer first, e.g. recorded or imported requests without a body
+		status := http.StatusOK
+		if r.Method == http.MethodPost {
+			status = http.StatusCreated
+		}
+		var handled bool
+		if w, handled = serveMatchingRule(w, r, file, body, status); handled {
+			return
+		}
+		if _, statusOnly := w.(*ruleStatusWriter); !statusOnly && schema == nil {
+			// Without a schema or rule the route does not take writes
+			r.Body = ioutil.NopCloser(bytes.NewReader(body)) // still forwarded by the proxy
+			methodNotAllowed(w, r)
+			return
+		}
+
+		if schema != nil {
+			var errs []schemaError
+			if schema.Query != nil {
+				errs = append(errs, validateInstance("query", schema.Query, parameterValues(r.URL.Query(), schema.raw["query"]))...)
+			}
+			if schema.Headers != nil {
+				headers := make(map[string][]string, len(r.Header))
+				for name, values := range r.Header {
+					headers[strings.ToLower(name)] = values
+				}
+				errs = append(errs, validateInstance("headers", schema.Headers, parameterValues(headers, schema.raw["headers"]))...)
+			}
+			if len(errs) > 0 {
+				rejectRequest(w, http.StatusBadRequest, "request parameters do not match "+schema.Source, errs)
+				return
+			}
+		}
+
+		// The body is only parsed when a schema checks it
+		if schema != nil && schema.Body != nil {
+			instance, err := jsonschema.UnmarshalJSON(bytes.NewReader(body))
+			if err != nil {
+				rejectRequest(w, http.StatusBadRequest, "request body is not valid JSON", []schemaError{{In: "body", Pointer: "", Message: err.Error()}})
+				return
+			}
+			bodySchema := schema.Body
+			if r.Method == http.MethodPatch && schema.Patch != nil {
+				bodySchema = schema.Patch
+			}
+			if errs := validateInstance("body", bodySchema, instance); len(errs) > 0 {
+				rejectRequest(w, http.StatusUnprocessableEntity, "request body does not match "+schema.Source, errs)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write(body)
+		log.Printf("The %s request to %s was accepted.", r.Method, route)
+		Lg.Infof("The %s request to %s was accepted.", r.Method, route)
+	}
+}
+
+func rejectRequest(w http.ResponseWriter, status int, message string, errs []schemaError) {
+	Lg.Infof("Rejected request: %s (%d errors)", message, len(errs))
+	writeJSON(w, status, map[string]interface{}{"error": message, "errors": errs})
+}
+
+// validateInstance lists the leaf errors of validating v, with the JSON
+// pointer of the failing value.
+func validateInstance(in string, schema *jsonschema.Schema, v interface{}) []schemaError {
+	err := schema.Validate(v)
+	if err == nil {
+		return nil
+	}
+	verr, ok := err.(*jsonschema.ValidationError)
+	if !ok {
+		return []schemaError{{In: in, Message: err.Error()}}
+	}
+	var errs []schemaError
+	var walk func(e *jsonschema.ValidationError)
+	walk = func(e *jsonschema.ValidationError) {
+		if len(e.Causes) > 0 {
+			for _, cause := range e.Causes {
+				walk(cause)
+			}
+			return
+		}
+		pointer := ""
+		for _, token := range e.InstanceLocation {
+			pointer += "/" + strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+		}
+		message := e.BasicOutput().Error.String()
+		errs = append(errs, schemaError{In: in, Pointer: pointer, Message: message})
+	}
+	walk(verr)
+	return errs
+}
+
+// parameterValues turns query or header values into a JSON object. Values are
+// strings unless the schema of the parameter asks for a number, an integer, a
+// boolean or an array.
+func parameterValues(values map[string][]string, raw interface{}) map[string]interface{} {
+	properties := map[string]interface{}{}
+	if object, ok := raw.(map[string]interface{}); ok {
+		properties, _ = object["properties"].(map[string]interface{})
+	}
+	result := make(map[string]interface{}, len(values))
+	for name, list := range values {
+		property, _ := properties[name].(map[string]interface{})
+		if schemaAllows(property, "array") {
+			items, _ := property["items"].(map[string]interface{})
+			converted := make([]interface{}, len(list))
+			for i, value := range list {
+				converted[i] = convertParameter(value, items)
+			}
+			result[name] = converted
+			continue
+		}
+		if len(list) > 0 {
+			result[name] = convertParameter(list[0], property)
+		}
+	}
+	return result
+}
+
+func convertParameter(value string, property map[string]interface{}) interface{} {
+	switch {
+	case schemaAllows(property, "integer"), schemaAllows(property, "number"):
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return json.Number(value)
+		}
+	case schemaAllows(property, "boolean"):
+		if b, err := strconv.ParseBool(value); err == nil {
+			return b
+		}
+	}
+	return value
+}
+
+// schemaAllows reports whether the "type" of a schema includes typ.
+func schemaAllows(property map[string]interface{}, typ string) bool {
+	switch t := property["type"].(type) {
+	case string:
+		return t == typ
+	case []interface{}:
+		for _, item := range t {
+			if item == typ {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestCreateWriteHandler(t *testing.T) {
+	t.Chdir(t.TempDir())
+	files := map[string]string{
+		"users.json":         `[{"name": "Ada", "age": 36}]`,
+		"users.schema.json":  `{"type": "object", "required": ["name"], "properties": {"name": {"type": "string"}}}`,
+		"orders.json":        `[{"id": 1}]`,
+		"orders.rules.json":  `{"rules": [{"method": "POST", "match": {"query": {"dry": "1"}}, "status": 202, "body": {"queued": true}}]}`,
+		"tickets.json":       `[]`,
+		"tickets.rules.json": `{"rules": [{"method": "DELETE", "status": 204}]}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusTeapot)
+		w.Write(body)
+	}))
+	defer upstream.Close()
+
+	savedFiles, savedProxy := routeFiles, proxyHandler
+	t.Cleanup(func() {
+		proxyHandler = savedProxy
+		routesLock.Lock()
+		routeFiles = savedFiles
+		routesLock.Unlock()
+	})
+	routesLock.Lock()
+	routeFiles = map[string]string{"/users": "users.json", "/orders": "orders.json", "/tickets": "tickets.json"}
+	routesLock.Unlock()
+	proxy, err := newProxyHandler(upstream.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		target string
+		body   string
+		proxy  http.Handler
+		status int
+		want   string
+	}{
+		{"valid body", http.MethodPost, "/users", `{"name": "Bob"}`, nil, http.StatusCreated, `{"name": "Bob"}`},
+		{"invalid body", http.MethodPut, "/users", `{"age": 3}`, nil, http.StatusUnprocessableEntity, "does not match"},
+		{"not JSON", http.MethodPatch, "/users", `name=Bob`, nil, http.StatusBadRequest, "not valid JSON"},
+		{"matching rule", http.MethodPost, "/orders?dry=1", `x`, nil, http.StatusAccepted, `"queued":true`},
+		{"no schema or rule", http.MethodPost, "/orders", `{"id": 2}`, nil, http.StatusMethodNotAllowed, ""},
+		{"other rules only", http.MethodPut, "/tickets", `{}`, nil, http.StatusMethodNotAllowed, ""},
+		{"proxied", http.MethodPost, "/orders", `{"id": 2}`, proxy, http.StatusTeapot, `{"id": 2}`},
+	}
+	for _, tt := range tests {
+		proxyHandler = tt.proxy
+		route := strings.SplitN(tt.target, "?", 2)[0]
+		w := httptest.NewRecorder()
+		createWriteHandler(route)(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader(tt.body)))
+		if w.Code != tt.status {
+			t.Errorf("%s: status %d, want %d (%s)", tt.name, w.Code, tt.status, w.Body)
+		}
+		if !strings.Contains(w.Body.String(), tt.want) {
+			t.Errorf("%s: body %s, want %s", tt.name, w.Body, tt.want)
+		}
+	}
+}
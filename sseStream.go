@@ -0,0 +1,251 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v7"
+)
+
+const (
+	streamSuffix        = "/stream"
+	defaultStreamPeriod = time.Second
+	streamKeepAlive     = 15 * time.Second
+)
+
+var (
+	streamLock      sync.Mutex
+	streamListeners = make(map[string]map[chan struct{}]bool) // route -> open streams
+	streamsStopped  = make(chan struct{})
+	stopStreamsOnce sync.Once
+)
+
+// streamOptions are read from the query string of a /name/stream request.
+type streamOptions struct {
+	Interval time.Duration // from ?interval=500ms or ?rate=<events per second>
+	Loop     bool          // start again after the last element
+	Generate bool          // send generated records instead of the file elements
+	Count    int           // stop after this many records, 0 means no limit
+	Seed     uint64
+	Start    int // index of the first element, after Last-Event-ID
+}
+
+func parseStreamOptions(r *http.Request, file string) (streamOptions, error) {
+	q := r.URL.Query()
+	opts := streamOptions{Interval: defaultStreamPeriod, Generate: isSampleFile(file)}
+	var err error
+	if v := q.Get("interval"); v != "" {
+		if opts.Interval, err = time.ParseDuration(v); err != nil || opts.Interval <= 0 {
+			return opts, fmt.Errorf("invalid interval %q", v)
+		}
+	}
+	if v := q.Get("rate"); v != "" {
+		rate, err := strconv.ParseFloat(v, 64)
+		if err != nil || rate <= 0 || rate > 1000 {
+			return opts, fmt.Errorf("invalid rate %q, expected 0 to 1000 events per second", v)
+		}
+		opts.Interval = time.Duration(float64(time.Second) / rate)
+	}
+	for name, target := range map[string]*bool{"loop": &opts.Loop, "generate": &opts.Generate} {
+		if v := q.Get(name); v != "" {
+			if *target, err = strconv.ParseBool(v); err != nil {
+				return opts, fmt.Errorf("invalid %s %q", name, v)
+			}
+		}
+	}
+	if v := q.Get("count"); v != "" {
+		if opts.Count, err = strconv.Atoi(v); err != nil || opts.Count < 0 {
+			return opts, fmt.Errorf("invalid count %q", v)
+		}
+	}
+	if v := q.Get("seed"); v != "" {
+		if opts.Seed, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return opts, fmt.Errorf("invalid seed %q", v)
+		}
+	}
+	// EventSource sends the id of the last received event when it reconnects
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		if id, err := strconv.Atoi(v); err == nil && id >= 0 {
+			opts.Start = id + 1
+		}
+	}
+	return opts, nil
+}
+
+// listenRouteChanges returns a channel signalled when the file of route changes.
+func listenRouteChanges(route string) (chan struct{}, func()) {
+	changed := make(chan struct{}, 1)
+	streamLock.Lock()
+	if streamListeners[route] == nil {
+		streamListeners[route] = make(map[chan struct{}]bool)
+	}
+	streamListeners[route][changed] = true
+	streamLock.Unlock()
+	return changed, func() {
+		streamLock.Lock()
+		delete(streamListeners[route], changed)
+		streamLock.Unlock()
+	}
+}
+
+// notifyRouteChanged signals all streams of route that its file changed.
+func notifyRouteChanged(route string) {
+	streamLock.Lock()
+	defer streamLock.Unlock()
+	for changed := range streamListeners[route] {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// stopEventStreams ends all open streams, so the server can shut down.
+func stopEventStreams() {
+	stopStreamsOnce.Do(func() { close(streamsStopped) })
+}
+
+// loadStreamElements returns the elements streamed from file. A file that is
+// not an array is streamed as a single element.
+func loadStreamElements(file string) ([]interface{}, interface{}, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	var content interface{}
+	if err := json.Unmarshal(data, &content); err != nil {
+		return nil, nil, fmt.Errorf("invalid JSON in %s: %v", file, err)
+	}
+	if items, ok := content.([]interface{}); ok {
+		return items, content, nil
+	}
+	return []interface{}{content}, content, nil
+}
+
+// createStreamHandler streams the file of route as Server-Sent Events: one
+// "record" event per element, a "changed" event with the new content when the
+// file changes and an "end" event after the last element unless looping.
+func createStreamHandler(route string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		file, ok := routeFile(route)
+		if !ok || isWebSocketMockFile(file) {
+			http.Error(w, "File not found", http.StatusNotFound)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+		opts, err := parseStreamOptions(r, file)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		elements, _, err := loadStreamElements(file)
+		if err != nil {
+			Lg.Errorf("Error reading stream file %s: %v", file, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		var gen *FakeGenerator
+		if opts.Generate {
+			if gen, err = newGeneratorFromFlags(); err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		changed, stopListening := listenRouteChanges(route)
+		defer stopListening()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.WriteHeader(http.StatusOK)
+		flusher.Flush()
+		log.Printf("Streaming %s to %s", file, r.RemoteAddr)
+		Lg.Infof("Streaming %s to %s", file, r.RemoteAddr)
+
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		keepAlive := time.NewTicker(streamKeepAlive)
+		defer keepAlive.Stop()
+
+		next, sent, ended := opts.Start, 0, false
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-streamsStopped:
+				return
+			case <-keepAlive.C:
+				fmt.Fprint(w, ": keep-alive\n\n")
+				flusher.Flush()
+			case <-changed:
+				newElements, content, err := loadStreamElements(file)
+				if err != nil {
+					continue // file.invalid was published by the watcher
+				}
+				elements = newElements
+				writeStreamEvent(w, "changed", -1, content)
+				flusher.Flush()
+			case <-ticker.C:
+				if ended {
+					continue
+				}
+				if opts.Count > 0 && sent >= opts.Count {
+					writeStreamEvent(w, "end", -1, map[string]int{"sent": sent})
+					flusher.Flush()
+					ended = true
+					continue
+				}
+				var record interface{}
+				switch {
+				case gen != nil && len(elements) > 0:
+					// Elements of the file are the templates of the generated records
+					if opts.Seed != 0 {
+						gen.Faker = gofakeit.New(opts.Seed*0x9E3779B97F4A7C15 + uint64(next) + 1)
+					}
+					record = gen.NewRecord(elements[next%len(elements)])
+				case next < len(elements):
+					record = elements[next]
+				case opts.Loop && len(elements) > 0:
+					next = 0
+					record = elements[0]
+				default:
+					writeStreamEvent(w, "end", -1, map[string]int{"sent": sent})
+					flusher.Flush()
+					ended = true
+					continue
+				}
+				if isPatternRoute(route) {
+					record = newTemplateContext(newRuleRequest(r, nil).values).renderTemplate(record)
+				}
+				writeStreamEvent(w, "record", next, record)
+				flusher.Flush()
+				next++
+				sent++
+			}
+		}
+	}
+}
+
+// writeStreamEvent writes one Server-Sent Event, id is omitted when negative.
+func writeStreamEvent(w http.ResponseWriter, event string, id int, data interface{}) {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		Lg.Errorf("Error encoding stream event: %v", err)
+		return
+	}
+	if id >= 0 {
+		fmt.Fprintf(w, "id: %d\n", id)
+	}
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, encoded)
+}
@@ -0,0 +1,199 @@
+// JSON editor panel of the GoEasyJson Web UI.
+let editorRoute = "";
+let editorModified = "";
+let editorSaved = "";
+
+function editorStatus(text) {
+    document.getElementById("edit-status").textContent = text;
+}
+
+function editorDirty() {
+    return editorRoute !== "" && document.getElementById("edit-content").value !== editorSaved;
+}
+
+async function editorLoadRoutes() {
+    try {
+        const resp = await fetch("/__admin/files");
+        const data = await resp.json();
+        const select = document.getElementById("edit-route");
+        const current = select.value;
+        select.length = 1;
+        (data.files || []).forEach(file => {
+            const opt = document.createElement("option");
+            opt.value = file.route;
+            opt.textContent = file.route + "  (" + file.file + ")";
+            select.appendChild(opt);
+        });
+        select.value = current;
+    } catch (e) {
+        console.error("Error loading routes:", e);
+    }
+}
+
+async function editorFetch(route) {
+    const resp = await fetch("/__admin/file?route=" + encodeURIComponent(route));
+    const data = await resp.json();
+    if (!resp.ok) {
+        throw new Error(data.error || resp.statusText);
+    }
+    return data;
+}
+
+// editorOpen loads the file of the selected route into the editor.
+async function editorOpen() {
+    const route = document.getElementById("edit-route").value;
+    if (!route) {
+        return;
+    }
+    if (editorDirty() && !confirm("Discard unsaved changes?")) {
+        document.getElementById("edit-route").value = editorRoute;
+        return;
+    }
+    try {
+        const data = await editorFetch(route);
+        editorRoute = route;
+        editorModified = data.modified;
+        editorSaved = data.content;
+        document.getElementById("edit-content").value = data.content;
+        document.getElementById("edit-diff").textContent = "";
+        editorStatus("Opened " + data.file);
+    } catch (e) {
+        editorStatus(e.message);
+    }
+}
+
+// editorValidate reports JSON syntax errors while typing.
+function editorValidate() {
+    const text = document.getElementById("edit-content").value;
+    try {
+        JSON.parse(text);
+        editorStatus(editorDirty() ? "Valid JSON, unsaved changes" : "Valid JSON");
+        return true;
+    } catch (e) {
+        editorStatus("Invalid JSON: " + e.message);
+        return false;
+    }
+}
+
+function editorFormat() {
+    const area = document.getElementById("edit-content");
+    if (editorValidate()) {
+        area.value = JSON.stringify(JSON.parse(area.value), null, 2);
+        editorValidate();
+    }
+}
+
+// editorLineDiff returns the line diff of a and b using the longest common subsequence.
+function editorLineDiff(a, b) {
+    const x = a.split("\n"), y = b.split("\n");
+    if (x.length * y.length > 4000000) {
+        return null;
+    }
+    const lcs = [];
+    for (let i = 0; i <= x.length; i++) {
+        lcs.push(new Uint32Array(y.length + 1));
+    }
+    for (let i = x.length - 1; i >= 0; i--) {
+        for (let j = y.length - 1; j >= 0; j--) {
+            lcs[i][j] = x[i] === y[j] ? lcs[i + 1][j + 1] + 1 : Math.max(lcs[i + 1][j], lcs[i][j + 1]);
+        }
+    }
+    const out = [];
+    let i = 0, j = 0;
+    while (i < x.length || j < y.length) {
+        if (i < x.length && j < y.length && x[i] === y[j]) {
+            out.push([" ", x[i]]); i++; j++;
+        } else if (j < y.length && (i >= x.length || lcs[i][j + 1] >= lcs[i + 1][j])) {
+            out.push(["+", y[j]]); j++;
+        } else {
+            out.push(["-", x[i]]); i++;
+        }
+    }
+    return out;
+}
+
+// editorDiff compares the editor content with the file on disk.
+async function editorDiff() {
+    if (!editorRoute) {
+        return;
+    }
+    try {
+        const data = await editorFetch(editorRoute);
+        const diff = editorLineDiff(data.content, document.getElementById("edit-content").value);
+        const pre = document.getElementById("edit-diff");
+        pre.innerHTML = "";
+        if (diff === null) {
+            pre.textContent = "File too large to diff.";
+            return;
+        }
+        let changes = 0;
+        diff.forEach(([op, line]) => {
+            const span = document.createElement("span");
+            span.className = op === "+" ? "diff-add" : op === "-" ? "diff-del" : "diff-same";
+            span.textContent = op + " " + line + "\n";
+            pre.appendChild(span);
+            if (op !== " ") {
+                changes++;
+            }
+        });
+        editorStatus(changes === 0 ? "No changes against disk" : changes + " changed lines against disk");
+    } catch (e) {
+        editorStatus(e.message);
+    }
+}
+
+async function editorSave(force) {
+    if (!editorRoute || !editorValidate()) {
+        return;
+    }
+    const content = document.getElementById("edit-content").value;
+    try {
+        const resp = await fetch("/__admin/file?route=" + encodeURIComponent(editorRoute), {
+            method: "PUT",
+            headers: { "Content-Type": "application/json" },
+            body: JSON.stringify({ content: content, modified: editorModified, force: force })
+        });
+        const data = await resp.json();
+        if (resp.status === 409) {
+            if (confirm(data.error + ". Overwrite anyway?")) {
+                editorSave(true);
+            }
+            return;
+        }
+        if (!resp.ok) {
+            throw new Error(data.error || resp.statusText);
+        }
+        editorModified = data.modified;
+        editorSaved = content;
+        editorStatus("Saved " + data.file);
+    } catch (e) {
+        editorStatus(e.message);
+    }
+}
+
+// editorOnServerUpdate is called for every WebSocket update: it refreshes the
+// route list and reloads the open file when it changed on disk.
+async function editorOnServerUpdate() {
+    editorLoadRoutes();
+    if (!editorRoute) {
+        return;
+    }
+    try {
+        const data = await editorFetch(editorRoute);
+        if (data.modified === editorModified) {
+            return;
+        }
+        if (editorDirty()) {
+            editorStatus("The file changed on disk, use Diff to compare or Save to overwrite");
+            return;
+        }
+        editorModified = data.modified;
+        editorSaved = data.content;
+        document.getElementById("edit-content").value = data.content;
+        editorStatus("Reloaded, the file changed on disk");
+    } catch (e) {
+        editorStatus(e.message);
+    }
+}
+
+document.addEventListener("DOMContentLoaded", editorLoadRoutes);
@@ -0,0 +1,128 @@
+// Fake data generator panel of the GoEasyJson Web UI.
+let genRules = [];
+let genFields = [];
+
+async function genRequest(url, body) {
+    const resp = await fetch(url, {
+        method: "POST",
+        headers: { "Content-Type": "application/json" },
+        body: JSON.stringify(body)
+    });
+    const data = await resp.json();
+    if (!resp.ok) {
+        throw new Error(data.error || resp.statusText);
+    }
+    return data;
+}
+
+function genMessage(text) {
+    document.getElementById("gen-message").textContent = text;
+}
+
+// genSettings collects the generator configuration from the form.
+function genSettings() {
+    const body = {
+        file: document.getElementById("gen-file").value,
+        quantity: parseInt(document.getElementById("gen-qty").value, 10) || 0,
+        seed: parseInt(document.getElementById("gen-seed").value, 10) || 0,
+        unique: document.getElementById("gen-unique").value,
+        autoinc: document.getElementById("gen-autoinc").value,
+        correlate: document.getElementById("gen-correlate").checked,
+        overrides: {}
+    };
+    if (!body.file) {
+        const text = document.getElementById("gen-sample").value.trim();
+        if (text) {
+            body.sample = JSON.parse(text);
+        }
+    }
+    document.querySelectorAll("#gen-fields select").forEach(sel => {
+        if (sel.value !== sel.dataset.auto) {
+            body.overrides[sel.dataset.path] = sel.value;
+        }
+    });
+    return body;
+}
+
+async function genLoadSamples() {
+    try {
+        const resp = await fetch("/__admin/generator/samples");
+        const data = await resp.json();
+        genRules = data.rules || [];
+        const select = document.getElementById("gen-file");
+        (data.files || []).forEach(file => {
+            const opt = document.createElement("option");
+            opt.value = file;
+            opt.textContent = file;
+            select.appendChild(opt);
+        });
+    } catch (e) {
+        console.error("Error loading sample files:", e);
+    }
+}
+
+// genAnalyze shows which generator rule matches every field of the sample.
+async function genAnalyze() {
+    try {
+        const body = genSettings();
+        body.overrides = {};
+        const data = await genRequest("/__admin/generator/analyze", body);
+        genRules = data.rules || genRules;
+        genFields = data.fields || [];
+        document.getElementById("gen-sample").value = JSON.stringify(data.sample, null, 2);
+        const tbody = document.querySelector("#gen-fields tbody");
+        tbody.innerHTML = "";
+        genFields.forEach(field => {
+            const tr = document.createElement("tr");
+            [field.path || "(root)", field.type, JSON.stringify(field.example)].forEach(text => {
+                const td = document.createElement("td");
+                td.textContent = text;
+                tr.appendChild(td);
+            });
+            const td = document.createElement("td");
+            const sel = document.createElement("select");
+            sel.className = "tool-select";
+            sel.dataset.path = field.path;
+            sel.dataset.auto = field.rule;
+            genRules.forEach(rule => {
+                const opt = document.createElement("option");
+                opt.value = rule;
+                opt.textContent = rule === field.rule ? rule + " (auto)" : rule;
+                sel.appendChild(opt);
+            });
+            sel.value = field.rule;
+            td.appendChild(sel);
+            tr.appendChild(td);
+            tbody.appendChild(tr);
+        });
+        genMessage(genFields.length + " fields analyzed");
+    } catch (e) {
+        genMessage(e.message);
+    }
+}
+
+async function genPreview() {
+    try {
+        const body = genSettings();
+        body.quantity = 3;
+        const data = await genRequest("/__admin/generator/preview", body);
+        document.getElementById("gen-preview").textContent = JSON.stringify(data.records, null, 2);
+        genMessage("");
+    } catch (e) {
+        genMessage(e.message);
+    }
+}
+
+async function genSave() {
+    try {
+        const body = genSettings();
+        body.name = document.getElementById("gen-name").value;
+        body.overwrite = document.getElementById("gen-overwrite").checked;
+        const data = await genRequest("/__admin/generator/save", body);
+        genMessage("Saved " + data.file + ", served at " + data.url);
+    } catch (e) {
+        genMessage(e.message);
+    }
+}
+
+document.addEventListener("DOMContentLoaded", genLoadSamples);
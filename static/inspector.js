@@ -0,0 +1,121 @@
+// Live request log panel of the GoEasyJson Web UI.
+const inspectorMax = 500;
+let inspectorRecords = [];
+let inspectorSelected = null;
+
+function inspectorFormatSize(bytes) {
+    return bytes < 1024 ? bytes + " B" : (bytes / 1024).toFixed(1) + " KB";
+}
+
+// inspectorMatches applies the filters of the panel to a record.
+function inspectorMatches(rec) {
+    const text = document.getElementById("req-filter").value.toLowerCase();
+    const method = document.getElementById("req-method").value;
+    const errors = document.getElementById("req-errors").checked;
+    if (method && rec.method !== method) {
+        return false;
+    }
+    if (errors && rec.status < 400) {
+        return false;
+    }
+    if (text) {
+        const haystack = (rec.path + "?" + rec.query + " " + rec.status + (rec.upstream ? " proxy" : "")).toLowerCase();
+        return haystack.includes(text);
+    }
+    return true;
+}
+
+function inspectorRender() {
+    const tbody = document.querySelector("#req-table tbody");
+    tbody.innerHTML = "";
+    const shown = inspectorRecords.filter(inspectorMatches);
+    shown.slice().reverse().forEach(rec => {
+        const tr = document.createElement("tr");
+        tr.className = "req-row" + (rec.status >= 400 ? " req-error" : "") + (rec.upstream ? " req-proxied" : "") + (inspectorSelected === rec.id ? " selected" : "");
+        tr.title = rec.upstream ? "Proxied to " + rec.upstream : "Mocked";
+        const cells = [
+            new Date(rec.time).toLocaleTimeString(),
+            rec.method,
+            (rec.upstream ? "⇄ " : "") + rec.path + (rec.query ? "?" + rec.query : ""),
+            rec.status,
+            rec.latencyMs.toFixed(1) + " ms",
+            inspectorFormatSize(rec.responseSize)
+        ];
+        cells.forEach(text => {
+            const td = document.createElement("td");
+            td.textContent = text;
+            tr.appendChild(td);
+        });
+        tr.onclick = () => inspectorShow(rec.id);
+        tbody.appendChild(tr);
+    });
+    document.getElementById("req-count").textContent = shown.length + " / " + inspectorRecords.length + " requests";
+}
+
+// inspectorShow fills the detail pane with one request.
+function inspectorShow(id) {
+    const rec = inspectorRecords.find(r => r.id === id);
+    if (!rec) {
+        return;
+    }
+    inspectorSelected = id;
+    const lines = [
+        rec.method + " " + rec.path + (rec.query ? "?" + rec.query : ""),
+        "Status: " + rec.status + "   Latency: " + rec.latencyMs.toFixed(2) + " ms   Size: " + inspectorFormatSize(rec.responseSize),
+        "Client: " + rec.remoteAddr + "   Time: " + new Date(rec.time).toLocaleString(),
+        rec.upstream ? "Proxied to: " + rec.upstream : "Answered by the mock",
+        "",
+        "Request headers:"
+    ];
+    Object.keys(rec.headers || {}).sort().forEach(k => lines.push("  " + k + ": " + rec.headers[k].join(", ")));
+    if (rec.query) {
+        lines.push("", "Query parameters:");
+        new URLSearchParams(rec.query).forEach((v, k) => lines.push("  " + k + " = " + v));
+    }
+    lines.push("", "Response headers:");
+    Object.keys(rec.responseHeaders || {}).sort().forEach(k => lines.push("  " + k + ": " + rec.responseHeaders[k].join(", ")));
+    if (rec.body) {
+        lines.push("", "Request body" + (rec.bodyTruncated ? " (truncated)" : "") + ":");
+        try {
+            lines.push(JSON.stringify(JSON.parse(rec.body), null, 2));
+        } catch (e) {
+            lines.push(rec.body);
+        }
+    }
+    document.getElementById("req-detail").textContent = lines.join("\n");
+    inspectorRender();
+}
+
+// inspectorAdd is called for every request pushed over the WebSocket.
+function inspectorAdd(rec) {
+    if (document.getElementById("req-paused").checked) {
+        return;
+    }
+    inspectorRecords.push(rec);
+    if (inspectorRecords.length > inspectorMax) {
+        inspectorRecords.shift();
+    }
+    inspectorRender();
+}
+
+async function inspectorClear() {
+    await fetch("/__admin/requests", { method: "DELETE" });
+    inspectorRecords = [];
+    inspectorSelected = null;
+    document.getElementById("req-detail").textContent = "";
+    inspectorRender();
+}
+
+async function inspectorLoadHistory() {
+    try {
+        const resp = await fetch("/__admin/requests");
+        const data = await resp.json();
+        const known = new Set(inspectorRecords.map(r => r.id));
+        inspectorRecords = (data.requests || []).filter(r => !known.has(r.id)).concat(inspectorRecords);
+        inspectorRender();
+    } catch (e) {
+        console.error("Error loading request history:", e);
+    }
+}
+
+document.addEventListener("DOMContentLoaded", inspectorLoadHistory);
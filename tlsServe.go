@@ -0,0 +1,262 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Files of the local certificate authority and the server certificate it
+// signs, kept in the configuration folder so the CA is trusted only once.
+const (
+	caCertName   = "goeasyjson-ca.pem"
+	caKeyName    = "goeasyjson-ca-key.pem"
+	leafCertName = "localhost.pem"
+	leafKeyName  = "localhost-key.pem"
+)
+
+// serverScheme is https when the server speaks TLS.
+func serverScheme() string {
+	if tlsEnabled {
+		return "https"
+	}
+	return "http"
+}
+
+// serverURL is the address of the server as shown to users.
+func serverURL() string {
+	return serverScheme() + "://" + displayHost() + ":" + strconv.Itoa(port)
+}
+
+// tlsCertDir is the folder of the generated certificates.
+func tlsCertDir() string {
+	if dir, err := os.UserConfigDir(); err == nil {
+		return filepath.Join(dir, "goeasyjson", "tls")
+	}
+	return filepath.Join(".goeasyjson", "tls")
+}
+
+// newTLSConfig returns the TLS settings of the server with the -cert/-key
+// pair, or with a certificate signed by the local CA, created when missing.
+func newTLSConfig() (*tls.Config, error) {
+	certFile, keyFile := tlsCertFile, tlsKeyFile
+	if certFile == "" && keyFile == "" {
+		var err error
+		if certFile, keyFile, err = ensureLocalCertificate(tlsCertDir()); err != nil {
+			return nil, fmt.Errorf("cannot create the local certificate: %v", err)
+		}
+	} else if certFile == "" || keyFile == "" {
+		return nil, errors.New("-cert and -key must be given together")
+	}
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("invalid certificate %s: %v", certFile, err)
+	}
+	config := &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	if enableHTTP2 {
+		config.NextProtos = []string{"h2", "http/1.1"}
+	} else {
+		config.NextProtos = []string{"http/1.1"}
+	}
+	return config, nil
+}
+
+// ensureLocalCertificate returns the server certificate of dir, signed by the
+// CA of dir. The certificate is issued again when it expires soon or does not
+// cover localhost and the current LAN addresses.
+func ensureLocalCertificate(dir string) (string, string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+	ca, caKey, err := loadOrCreateCA(dir)
+	if err != nil {
+		return "", "", err
+	}
+	certFile, keyFile := filepath.Join(dir, leafCertName), filepath.Join(dir, leafKeyName)
+	hosts, ips := localHostNames()
+	if leaf, err := readCertificate(certFile); err == nil && leaf.CheckSignatureFrom(ca) == nil &&
+		time.Until(leaf.NotAfter) > 7*24*time.Hour && coversHosts(leaf, hosts, ips) {
+		if _, err := os.Stat(keyFile); err == nil {
+			return certFile, keyFile, nil
+		}
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return "", "", err
+	}
+	template := &x509.Certificate{
+		SerialNumber: randomSerial(),
+		Subject:      pkix.Name{Organization: []string{"GoEasyJson"}, CommonName: "localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().AddDate(0, 0, 825), // the longest validity browsers accept
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     hosts,
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		return "", "", err
+	}
+	if err := writePEM(certFile, "CERTIFICATE", der, 0644); err != nil {
+		return "", "", err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", "", err
+	}
+	if err := writePEM(keyFile, "EC PRIVATE KEY", keyDER, 0600); err != nil {
+		return "", "", err
+	}
+	log.Printf("Issued %s for %v %v", certFile, hosts, ips)
+	Lg.Infof("Issued %s for %v %v", certFile, hosts, ips)
+	return certFile, keyFile, nil
+}
+
+// loadOrCreateCA reads the local CA of dir, creating it on the first run.
+func loadOrCreateCA(dir string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certFile, keyFile := filepath.Join(dir, caCertName), filepath.Join(dir, caKeyName)
+	if ca, err := readCertificate(certFile); err == nil && time.Now().Before(ca.NotAfter) {
+		data, err := ioutil.ReadFile(keyFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, nil, fmt.Errorf("invalid key %s", keyFile)
+		}
+		key, err := x509.ParseECPrivateKey(block.Bytes)
+		return ca, key, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	hostname, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber:          randomSerial(),
+		Subject:               pkix.Name{Organization: []string{"GoEasyJson"}, CommonName: "GoEasyJson local CA " + hostname},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writePEM(keyFile, "EC PRIVATE KEY", keyDER, 0600); err != nil {
+		return nil, nil, err
+	}
+	if err := writePEM(certFile, "CERTIFICATE", der, 0644); err != nil {
+		return nil, nil, err
+	}
+	fmt.Println(LightYellow.Render("Created the local certificate authority " + certFile + ",\ntrust it in your browser or system to avoid certificate warnings."))
+	Lg.Infof("Created the local certificate authority %s", certFile)
+	ca, err := x509.ParseCertificate(der)
+	return ca, key, err
+}
+
+// localHostNames returns the names and addresses the server certificate is
+// issued for: localhost, the host name and every LAN address.
+func localHostNames() ([]string, []net.IP) {
+	hosts := []string{"localhost"}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" && hostname != "localhost" {
+		hosts = append(hosts, hostname)
+	}
+	if bindHost != "" && bindHost != "localhost" && net.ParseIP(bindHost) == nil {
+		hosts = append(hosts, bindHost) // -host my-laptop.local
+	}
+	ips := []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback}
+	addrs, err := net.InterfaceAddrs()
+	if err != nil {
+		return hosts, ips
+	}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+			ips = append(ips, ipNet.IP)
+		}
+	}
+	return hosts, ips
+}
+
+// coversHosts reports whether cert is valid for every host and address.
+func coversHosts(cert *x509.Certificate, hosts []string, ips []net.IP) bool {
+	for _, host := range hosts {
+		if cert.VerifyHostname(host) != nil {
+			return false
+		}
+	}
+	for _, ip := range ips {
+		if cert.VerifyHostname(ip.String()) != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func readCertificate(file string) (*x509.Certificate, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("no certificate in %s", file)
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func writePEM(file, blockType string, der []byte, perm os.FileMode) error {
+	return writeFileAtomic(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), perm)
+}
+
+func randomSerial() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
+
+// serveHTTPSRedirect answers plain HTTP requests on redirectPort with a
+// redirect to the same URL on the HTTPS port.
+func serveHTTPSRedirect(redirectPort int) {
+	redirect := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if h, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = h
+		}
+		target := "https://" + net.JoinHostPort(host, strconv.Itoa(port)) + r.URL.RequestURI()
+		http.Redirect(w, r, target, http.StatusPermanentRedirect)
+	})
+	log.Printf("Redirecting http://%s:%d to %s", displayHost(), redirectPort, serverURL())
+	Lg.Infof("Redirecting http://%s:%d to %s", displayHost(), redirectPort, serverURL())
+	if err := http.ListenAndServe(listenAddress(redirectPort), restrictClients(redirect)); err != nil {
+		log.Printf("HTTP redirect listener error: %v", err)
+		Lg.Errorf("HTTP redirect listener error: %v", err)
+	}
+}
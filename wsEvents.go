@@ -0,0 +1,265 @@
+package main
+
+import (
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// EventProtocolVersion is sent in every WebSocket event envelope.
+const EventProtocolVersion = 1
+
+// WebSocket event types.
+const (
+	EventSnapshot      = "snapshot"       // sent once to every new client
+	EventRouteAdded    = "route.added"    // a JSON file became a route
+	EventRouteRemoved  = "route.removed"  // the file of a route disappeared
+	EventRouteChanged  = "route.changed"  // the file of a route was modified
+	EventFileInvalid   = "file.invalid"   // a served file does not contain valid JSON
+	EventRequestServed = "request.served" // a request was handled, see RequestRecord
+	EventConfigChanged = "config.changed" // the runtime configuration changed
+	EventServerStatus  = "server.status"  // periodic server state
+)
+
+// Event is the envelope of every message sent over /ws.
+type Event struct {
+	Version int         `json:"v"`
+	Type    string      `json:"type"`
+	Data    interface{} `json:"data"`
+	Time    int64       `json:"ts"` // Unix time in milliseconds
+}
+
+// RouteInfo describes a served route in WebSocket events.
+type RouteInfo struct {
+	Route  string `json:"route"`
+	URL    string `json:"url"`
+	File   string `json:"file,omitempty"`
+	Kind   string `json:"kind"`             // json, sample or websocket
+	Stream string `json:"stream,omitempty"` // Server-Sent Events URL of the route
+}
+
+// ServerStatus is the data of server.status events.
+type ServerStatus struct {
+	State         string `json:"state"`
+	Version       string `json:"version"`
+	Port          int    `json:"port"`
+	UptimeSeconds int64  `json:"uptimeSeconds"`
+	Routes        int    `json:"routes"`
+	Requests      uint64 `json:"requests"`
+	Clients       int    `json:"clients"`
+}
+
+// clientMessage is sent by WebSocket clients to choose the event types they receive.
+// Types may end with ".*" to match a whole family, e.g. "route.*".
+type clientMessage struct {
+	Type  string   `json:"type"` // subscribe or unsubscribe
+	Types []string `json:"types"`
+}
+
+// Broadcast carries events to all connected WebSocket clients.
+var Broadcast = make(chan Event, 256)
+
+var serverStarted = time.Now()
+
+// publishEvent broadcasts an event of the given type to subscribed clients.
+func publishEvent(eventType string, data interface{}) {
+	select {
+	case Broadcast <- newEvent(eventType, data):
+	case <-hub.done:
+		// The server is shutting down
+	}
+}
+
+func newEvent(eventType string, data interface{}) Event {
+	return Event{Version: EventProtocolVersion, Type: eventType, Data: data, Time: time.Now().UnixMilli()}
+}
+
+// routeURL returns the URL of a route as shown to users.
+func routeURL(route string) string {
+	return serverURL() + route
+}
+
+// newRouteInfo describes the route served by file.
+func newRouteInfo(route, file string) RouteInfo {
+	info := RouteInfo{Route: route, URL: routeURL(route), File: file, Kind: "json", Stream: routeURL(route + streamSuffix)}
+	switch {
+	case isSampleFile(file):
+		info.Kind = "sample"
+	case isWebSocketMockFile(file):
+		info.Kind = "websocket"
+		info.URL = "ws" + strings.TrimPrefix(info.URL, "http")
+		info.Stream = ""
+	}
+	if strings.HasSuffix(route, catchAllSuffix) {
+		info.Stream = "" // the catch-all takes /stream as part of the path
+	}
+	return info
+}
+
+// routeInfos returns all served routes sorted by path.
+func routeInfos() []RouteInfo {
+	routesLock.RLock()
+	infos := make([]RouteInfo, 0, len(routes))
+	for route := range routes {
+		infos = append(infos, newRouteInfo(route, routeFiles[route]))
+	}
+	routesLock.RUnlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Route < infos[j].Route })
+	return infos
+}
+
+// routeForFile returns the route served by file, which may be absolute or relative.
+func routeForFile(file string) (string, bool) {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", false
+	}
+	routesLock.RLock()
+	defer routesLock.RUnlock()
+	for route, f := range routeFiles {
+		if fAbs, err := filepath.Abs(f); err == nil && fAbs == abs {
+			return route, true
+		}
+	}
+	return "", false
+}
+
+// checkChangedFile publishes file.invalid when a served file is not valid JSON,
+// otherwise route.changed if the route already existed before the change.
+func checkChangedFile(changed string, existed bool) {
+	route, ok := routeForFile(changed)
+	if !ok {
+		return
+	}
+	file, ok := routeFile(route)
+	if !ok {
+		return
+	}
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return
+	}
+	if err := validateJSONText(content); err != nil {
+		Lg.Warnf("JSON file %s is invalid: %v", file, err)
+		log.Printf("JSON file %s is invalid: %v", file, err)
+		publishEvent(EventFileInvalid, map[string]string{"route": route, "file": file, "error": err.Error()})
+		return
+	}
+	notifyRouteChanged(route)
+	invalidateGraphQLSchema()
+	if existed {
+		publishEvent(EventRouteChanged, newRouteInfo(route, file))
+	}
+}
+
+func currentServerStatus() ServerStatus {
+	routesLock.RLock()
+	routeCount := len(routes)
+	routesLock.RUnlock()
+	return ServerStatus{
+		State:         "running",
+		Version:       CurrentVersion,
+		Port:          port,
+		UptimeSeconds: int64(time.Since(serverStarted).Seconds()),
+		Routes:        routeCount,
+		Requests:      atomic.LoadUint64(&requestSeq),
+		Clients:       hub.clientCount(),
+	}
+}
+
+// currentConfig returns the runtime settings shown to WebSocket clients.
+func currentConfig() map[string]interface{} {
+	return map[string]interface{}{
+		"port":      port,
+		"samples":   samplesDir,
+		"proxy":     proxyTarget,
+		"record":    recordMode,
+		"tls":       tlsEnabled,
+		"auth":      authFile,
+		"cors":      corsOrigins,
+		"host":      bindHost,
+		"rateLimit": globalRateLimit(),
+	}
+}
+
+// snapshotEvent describes the whole server state for a newly connected client.
+func snapshotEvent() Event {
+	infos := routeInfos()
+	endpoints := make([]string, len(infos))
+	for i, info := range infos {
+		endpoints[i] = info.URL
+	}
+	return newEvent(EventSnapshot, map[string]interface{}{
+		"routes":    infos,
+		"endpoints": endpoints,
+		"server":    currentServerStatus(),
+		"config":    currentConfig(),
+		"addresses": reachableURLs(),
+	})
+}
+
+// reportServerStatus publishes server.status periodically.
+func reportServerStatus(interval time.Duration) {
+	publishEvent(EventServerStatus, currentServerStatus())
+	for range time.Tick(interval) {
+		publishEvent(EventServerStatus, currentServerStatus())
+	}
+}
+
+// subscriptions are the event types a client wants. Types may end with ".*"
+// to match a whole family, e.g. "route.*". No included types means all types.
+type subscriptions struct {
+	include map[string]bool
+	exclude map[string]bool
+}
+
+func parseEventTypes(list string) *subscriptions {
+	subs := &subscriptions{include: make(map[string]bool), exclude: make(map[string]bool)}
+	for _, t := range strings.Split(list, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			subs.include[t] = true
+		}
+	}
+	return subs
+}
+
+func matchesEventType(set map[string]bool, eventType string) bool {
+	if set[eventType] {
+		return true
+	}
+	i := strings.IndexByte(eventType, '.')
+	return i > 0 && set[eventType[:i]+".*"]
+}
+
+// wants reports whether an event type matches the subscriptions.
+func (s *subscriptions) wants(eventType string) bool {
+	if eventType == EventSnapshot {
+		return true
+	}
+	if matchesEventType(s.exclude, eventType) {
+		return false
+	}
+	return len(s.include) == 0 || matchesEventType(s.include, eventType)
+}
+
+// apply updates the subscriptions from a client message: subscribe replaces
+// the subscribed types, unsubscribe stops the given types.
+func (s *subscriptions) apply(msg clientMessage) {
+	switch msg.Type {
+	case "subscribe":
+		s.include = make(map[string]bool)
+		s.exclude = make(map[string]bool)
+		for _, t := range msg.Types {
+			s.include[t] = true
+		}
+	case "unsubscribe":
+		for _, t := range msg.Types {
+			delete(s.include, t)
+			s.exclude[t] = true
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	wsWriteWait      = 10 * time.Second    // time allowed to write a message
+	wsPongWait       = 60 * time.Second    // time allowed to read the next pong
+	wsPingPeriod     = wsPongWait * 9 / 10 // send pings before the pong deadline
+	wsMaxMessageSize = 4096                // largest message accepted from clients
+	wsSendQueueLen   = 256                 // messages queued per client
+)
+
+// droppableEvents may be skipped for a slow client. For any other event a full
+// send queue disconnects the client, which gets a fresh snapshot on reconnect.
+var droppableEvents = map[string]bool{
+	EventRequestServed: true,
+	EventServerStatus:  true,
+}
+
+// wsClient is a connected Web UI or API client.
+type wsClient struct {
+	conn *websocket.Conn
+	send chan []byte // buffered queue drained by writePump
+
+	subsLock sync.Mutex
+	subs     *subscriptions
+	dropped  uint64
+	closing  []byte // close frame sent when the hub closes the send queue
+}
+
+// Hub owns all WebSocket clients. Only its run goroutine touches the client
+// set, publishers never block on a slow client.
+type Hub struct {
+	clients    map[*wsClient]bool
+	register   chan *wsClient
+	unregister chan *wsClient
+	broadcast  chan Event
+	closing    chan chan struct{}
+	done       chan struct{} // closed when run returns
+	writers    sync.WaitGroup
+	count      int64
+}
+
+var hub = newHub(Broadcast)
+
+func newHub(broadcast chan Event) *Hub {
+	return &Hub{
+		clients:    make(map[*wsClient]bool),
+		register:   make(chan *wsClient),
+		unregister: make(chan *wsClient),
+		broadcast:  broadcast,
+		closing:    make(chan chan struct{}),
+		done:       make(chan struct{}),
+	}
+}
+
+func (h *Hub) clientCount() int {
+	return int(atomic.LoadInt64(&h.count))
+}
+
+// run delivers events to clients and handles (un)registration.
+func (h *Hub) run() {
+	defer close(h.done)
+	for {
+		select {
+		case client := <-h.register:
+			h.clients[client] = true
+			atomic.StoreInt64(&h.count, int64(len(h.clients)))
+			if data, err := json.Marshal(snapshotEvent()); err == nil {
+				client.send <- data
+			}
+		case client := <-h.unregister:
+			h.remove(client)
+		case event := <-h.broadcast:
+			h.deliver(event)
+		case done := <-h.closing:
+			// Deliver what was published before the shutdown, e.g. the stopping status
+			for pending := true; pending; {
+				select {
+				case event := <-h.broadcast:
+					h.deliver(event)
+				default:
+					pending = false
+				}
+			}
+			for client := range h.clients {
+				client.closing = websocket.FormatCloseMessage(websocket.CloseGoingAway, "server shutting down")
+				h.remove(client)
+			}
+			close(done)
+			return
+		}
+	}
+}
+
+// deliver queues an event for every subscribed client without waiting for them.
+func (h *Hub) deliver(event Event) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		Lg.Errorf("Error marshaling %s event: %v", event.Type, err)
+		return
+	}
+	for client := range h.clients {
+		if !client.wants(event.Type) {
+			continue
+		}
+		select {
+		case client.send <- data:
+		default:
+			if droppableEvents[event.Type] {
+				client.dropped++
+				continue
+			}
+			Lg.Warnf("Disconnecting slow WebSocket client %s (%d events dropped before)", client.conn.RemoteAddr(), client.dropped)
+			client.closing = websocket.FormatCloseMessage(websocket.CloseTryAgainLater, "client too slow")
+			h.remove(client)
+		}
+	}
+}
+
+// remove closes the send queue of a client, its writePump then sends the
+// queued messages and the close frame and closes the connection.
+func (h *Hub) remove(client *wsClient) {
+	if h.clients[client] {
+		delete(h.clients, client)
+		close(client.send)
+		atomic.StoreInt64(&h.count, int64(len(h.clients)))
+	}
+}
+
+// Close sends the pending events and a close frame to every client and stops the hub.
+func (h *Hub) Close() {
+	done := make(chan struct{})
+	select {
+	case h.closing <- done:
+		<-done
+	case <-time.After(2 * time.Second):
+		return
+	}
+	flushed := make(chan struct{})
+	go func() {
+		h.writers.Wait()
+		close(flushed)
+	}()
+	select {
+	case <-flushed:
+	case <-time.After(wsWriteWait):
+	}
+}
+
+func (c *wsClient) wants(eventType string) bool {
+	c.subsLock.Lock()
+	defer c.subsLock.Unlock()
+	return c.subs.wants(eventType)
+}
+
+// readPump handles subscription messages and pongs until the connection fails.
+func (c *wsClient) readPump() {
+	defer func() {
+		select {
+		case hub.unregister <- c:
+		case <-hub.done:
+		}
+	}()
+	c.conn.SetReadLimit(wsMaxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(wsPongWait))
+	})
+	for {
+		_, data, err := c.conn.ReadMessage()
+		if err != nil {
+			log.Println("WebSocket client disconnected")
+			return
+		}
+		var msg clientMessage
+		if err := json.Unmarshal(data, &msg); err == nil {
+			c.subsLock.Lock()
+			c.subs.apply(msg)
+			c.subsLock.Unlock()
+		}
+	}
+}
+
+// writePump writes queued messages and periodic pings to the connection.
+func (c *wsClient) writePump() {
+	ticker := time.NewTicker(wsPingPeriod)
+	defer func() {
+		hub.writers.Done()
+		ticker.Stop()
+		c.conn.Close()
+	}()
+	for {
+		select {
+		case data, ok := <-c.send:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if !ok {
+				// The hub closed the queue
+				c.conn.WriteMessage(websocket.CloseMessage, c.closing)
+				return
+			}
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// WebSocket升级器
+var upgrader = websocket.Upgrader{
+	CheckOrigin: checkWebSocketOrigin, // 只接受同源及 -cors 允许的来源
+}
+
+// handleWebSocket registers a new client. It receives a snapshot first and then
+// the events it subscribed to, via ?types=route.*,request.served or subscribe messages.
+func handleWebSocket(w http.ResponseWriter, r *http.Request) {
+	// 升级HTTP连接为WebSocket连接
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	log.Println("New WebSocket client connected")
+
+	client := &wsClient{
+		conn: conn,
+		send: make(chan []byte, wsSendQueueLen),
+		subs: parseEventTypes(r.URL.Query().Get("types")),
+	}
+	hub.writers.Add(1)
+	select {
+	case hub.register <- client:
+	case <-hub.done:
+		hub.writers.Done()
+		conn.Close()
+		return
+	}
+	go client.writePump()
+	go client.readPump()
+}
+
+// shutdownOnSignal closes WebSocket clients with a going-away frame and stops
+// the server gracefully on Ctrl+C or SIGTERM.
+func shutdownOnSignal(server *http.Server) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	<-signals
+	log.Println("Shutting down server...")
+	Lg.Infof("Shutting down server")
+
+	status := currentServerStatus()
+	status.State = "stopping"
+	publishEvent(EventServerStatus, status)
+	hub.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := server.Shutdown(ctx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+}
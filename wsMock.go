@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/gorilla/websocket"
+)
+
+const wsMockSuffix = ".ws.json"
+
+// wsMockScript is the content of a *.ws.json file, it scripts a mocked WebSocket endpoint:
+//
+//	{
+//	  "onConnect": [{"type": "welcome", "user": "{{fake.name}}"}],
+//	  "periodic":  [{"interval": "5s", "message": {"type": "tick", "at": "{{now}}"}}],
+//	  "rules": [
+//	    {"match": {"type": "ping"}, "reply": {"type": "pong"}},
+//	    {"regex": "^hello (\\w+)$", "reply": "hi {{match.1}}", "delay": "200ms"}
+//	  ],
+//	  "default": {"error": "unknown message"}
+//	}
+//
+// String messages are sent as text, any other JSON value is sent encoded.
+// Messages may contain the placeholders of templateContext, rules can also use
+// {{message.field}} of the incoming JSON message and {{match.N}} of the regex.
+type wsMockScript struct {
+	OnConnect []interface{} `json:"onConnect"`
+	Periodic  []wsMockPush  `json:"periodic"`
+	Rules     []wsMockRule  `json:"rules"`
+	Default   interface{}   `json:"default"` // reply when no rule matches, nothing if empty
+	compiled  []*regexp.Regexp
+}
+
+// wsMockPush is a message sent repeatedly to every connection.
+type wsMockPush struct {
+	Interval string      `json:"interval"` // Go duration, e.g. "500ms" or "5s"
+	Times    int         `json:"times"`    // number of pushes, 0 means until disconnect
+	Message  interface{} `json:"message"`
+	every    time.Duration
+}
+
+// wsMockRule answers incoming messages. All given conditions must match:
+// Match compares fields of a JSON message ("*" matches any value), Regex is
+// applied to the raw message text.
+type wsMockRule struct {
+	Match   map[string]interface{} `json:"match"`
+	Regex   string                 `json:"regex"`
+	Reply   interface{}            `json:"reply"`
+	Replies []interface{}          `json:"replies"` // several replies sent in order
+	Delay   string                 `json:"delay"`
+	delay   time.Duration
+}
+
+// isWebSocketMockFile reports whether file scripts a mocked WebSocket endpoint.
+func isWebSocketMockFile(file string) bool {
+	return strings.HasSuffix(strings.ToLower(file), wsMockSuffix)
+}
+
+// loadWebSocketMock reads and checks a *.ws.json script.
+func loadWebSocketMock(file string) (*wsMockScript, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	script := &wsMockScript{}
+	if err := json.Unmarshal(data, script); err != nil {
+		return nil, fmt.Errorf("invalid WebSocket script %s: %v", file, err)
+	}
+	for i := range script.Periodic {
+		push := &script.Periodic[i]
+		if push.every, err = time.ParseDuration(push.Interval); err != nil || push.every <= 0 {
+			return nil, fmt.Errorf("invalid interval %q in %s", push.Interval, file)
+		}
+	}
+	script.compiled = make([]*regexp.Regexp, len(script.Rules))
+	for i := range script.Rules {
+		rule := &script.Rules[i]
+		if rule.Regex != "" {
+			if script.compiled[i], err = regexp.Compile(rule.Regex); err != nil {
+				return nil, fmt.Errorf("invalid regex %q in %s: %v", rule.Regex, file, err)
+			}
+		}
+		if rule.Delay != "" {
+			if rule.delay, err = time.ParseDuration(rule.Delay); err != nil {
+				return nil, fmt.Errorf("invalid delay %q in %s", rule.Delay, file)
+			}
+		}
+	}
+	return script, nil
+}
+
+// wsMockConn is one client connection of a mocked WebSocket endpoint.
+type wsMockConn struct {
+	conn      *websocket.Conn
+	script    *wsMockScript
+	query     map[string]string
+	path      map[string]string // parameters of a route such as /rooms/{room}
+	claims    map[string]interface{}
+	writeLock sync.Mutex
+	done      chan struct{}
+}
+
+// serveWebSocketMock upgrades the request and runs the script of file for the connection.
+// The script is read on connect, changes apply to new connections.
+func serveWebSocketMock(w http.ResponseWriter, r *http.Request, file string) {
+	if !websocket.IsWebSocketUpgrade(r) {
+		writeJSONError(w, http.StatusUpgradeRequired, "this route is a WebSocket endpoint, connect with ws:// or wss://")
+		return
+	}
+	script, err := loadWebSocketMock(file)
+	if err != nil {
+		Lg.Errorf("%v", err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	log.Printf("WebSocket mock %s connected", file)
+	Lg.Infof("WebSocket mock %s connected from %s", file, r.RemoteAddr)
+
+	query := make(map[string]string)
+	for key, values := range r.URL.Query() {
+		query[key] = values[0]
+	}
+	mc := &wsMockConn{conn: conn, script: script, query: query, path: mux.Vars(r), claims: requestClaims(r), done: make(chan struct{})}
+	defer func() {
+		close(mc.done)
+		conn.Close()
+		Lg.Infof("WebSocket mock %s disconnected", file)
+	}()
+
+	for _, message := range script.OnConnect {
+		mc.send(message, nil)
+	}
+	for _, push := range script.Periodic {
+		go mc.push(push)
+	}
+	mc.readLoop()
+}
+
+// readLoop answers incoming messages until the connection is closed.
+func (mc *wsMockConn) readLoop() {
+	for seq := 1; ; seq++ {
+		_, data, err := mc.conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		var message interface{}
+		if err := json.Unmarshal(data, &message); err != nil {
+			message = string(data)
+		}
+		values := map[string]interface{}{"message": message, "seq": seq}
+
+		rule, ok := mc.script.matchRule(data, message, values)
+		if !ok {
+			if mc.script.Default != nil {
+				mc.send(mc.script.Default, values)
+			}
+			continue
+		}
+		replies := rule.Replies
+		if rule.Reply != nil {
+			replies = append([]interface{}{rule.Reply}, replies...)
+		}
+		if rule.delay > 0 {
+			// Reply later without blocking the following messages
+			go func() {
+				select {
+				case <-time.After(rule.delay):
+					for _, reply := range replies {
+						mc.send(reply, values)
+					}
+				case <-mc.done:
+				}
+			}()
+			continue
+		}
+		for _, reply := range replies {
+			mc.send(reply, values)
+		}
+	}
+}
+
+// matchRule returns the first rule matching an incoming message. The regex
+// groups are added to values as "match".
+func (s *wsMockScript) matchRule(data []byte, message interface{}, values map[string]interface{}) (*wsMockRule, bool) {
+	for i := range s.Rules {
+		rule := &s.Rules[i]
+		if !matchFields(message, rule.Match) {
+			continue
+		}
+		if re := s.compiled[i]; re != nil {
+			groups := re.FindStringSubmatch(string(data))
+			if groups == nil {
+				continue
+			}
+			values["match"] = groups
+		}
+		return rule, true
+	}
+	return nil, false
+}
+
+// matchFields reports whether every field path of expected has the expected value in message.
+func matchFields(message interface{}, expected map[string]interface{}) bool {
+	for path, want := range expected {
+		got, ok := lookupJSONPath(message, path)
+		if !ok {
+			return false
+		}
+		if want == "*" {
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			return false
+		}
+	}
+	return true
+}
+
+// push sends a periodic message until the connection closes.
+func (mc *wsMockConn) push(push wsMockPush) {
+	ticker := time.NewTicker(push.every)
+	defer ticker.Stop()
+	for sent := 0; push.Times <= 0 || sent < push.Times; sent++ {
+		select {
+		case <-ticker.C:
+			mc.send(push.Message, map[string]interface{}{"seq": sent + 1})
+		case <-mc.done:
+			return
+		}
+	}
+}
+
+// send renders a scripted message and writes it to the connection.
+func (mc *wsMockConn) send(message interface{}, values map[string]interface{}) {
+	if values == nil {
+		values = make(map[string]interface{})
+	}
+	values["query"] = mc.query
+	values["path"] = mc.path
+	values["claims"] = mc.claims
+	rendered := newTemplateContext(values).renderTemplate(message)
+
+	var data []byte
+	if text, ok := rendered.(string); ok {
+		data = []byte(text)
+	} else {
+		var err error
+		if data, err = json.Marshal(rendered); err != nil {
+			Lg.Errorf("Error encoding WebSocket mock message: %v", err)
+			return
+		}
+	}
+
+	mc.writeLock.Lock()
+	defer mc.writeLock.Unlock()
+	mc.conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+	mc.conn.WriteMessage(websocket.TextMessage, data)
+}